@@ -1,6 +1,7 @@
 package logging
 
 import (
+	"context"
 	"os"
 	"runtime"
 	"time"
@@ -36,6 +37,7 @@ func SetupLog(name string) {
 		Formatter: &log.JSONFormatter{DisableTimestamp: true},
 	}
 	log.SetFormatter(f)
+	log.AddHook(requestIDHook{})
 	log.SetLevel(log.InfoLevel)
 	if viper.GetBool(cst.EnvVerbose) {
 		log.SetLevel(log.DebugLevel)
@@ -54,3 +56,36 @@ func WithFuncName() *logrus.Entry {
 	}
 	return log.WithField(cst.LogFieldFuncName, funcName)
 }
+
+type ctxKey int
+
+const ctxKeyRequestID ctxKey = iota
+
+// NewContext returns a copy of ctx carrying the given request ID. Entries logged with the returned context, i.e.
+// via (*logrus.Entry).WithContext, are marked with the request ID
+func NewContext(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, ctxKeyRequestID, requestID)
+}
+
+// RequestID returns the request ID carried by ctx, or empty string if there is none
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(ctxKeyRequestID).(string)
+	return id
+}
+
+// requestIDHook marks log entries with the request ID carried by their contexts
+type requestIDHook struct{}
+
+func (requestIDHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (requestIDHook) Fire(e *log.Entry) error {
+	if id := RequestID(e.Context); id != "" {
+		e.Data[cst.LogFieldRequestID] = id
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	cst "wuyrush.io/pin/constants"
+)
+
+func TestRequestIDHook(t *testing.T) {
+	tcs := []struct {
+		name string
+		ctx  context.Context
+		exp  interface{}
+	}{
+		{name: "with request id", ctx: NewContext(context.Background(), "req-1"), exp: "req-1"},
+		{name: "without request id", ctx: context.Background()},
+		{name: "without context"},
+	}
+	for _, c := range tcs {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			l := log.New()
+			l.SetOutput(&buf)
+			l.SetFormatter(&log.JSONFormatter{})
+			l.AddHook(requestIDHook{})
+			e := log.NewEntry(l)
+			if c.ctx != nil {
+				e = e.WithContext(c.ctx)
+			}
+			e.Info("hello")
+			m := map[string]interface{}{}
+			if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if actual := m[cst.LogFieldRequestID]; actual != c.exp {
+				t.Errorf("expected request id %v but got %v", c.exp, actual)
+			}
+		})
+	}
+}
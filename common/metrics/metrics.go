@@ -0,0 +1,125 @@
+// Package metrics vends Prometheus metrics of pin service components.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "pin"
+
+// server metrics
+var (
+	RequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of HTTP requests by route, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+	PinsCreated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "pins_created_total",
+		Help:      "Number of pins created by access mode.",
+	}, []string{"mode"})
+	AttachmentBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "attachment_bytes_stored_total",
+		Help:      "Size of pin attachments stored in bytes.",
+	})
+)
+
+// deleter metrics
+var (
+	JunkBacklog = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "deleter",
+		Name:      "junk_backlog",
+		Help:      "Number of expired or burnt pins waiting for deletion, as of the latest sweep.",
+	})
+	SweepDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "deleter",
+		Name:      "sweep_duration_seconds",
+		Help:      "Time taken to load and delete junk pins of a sweep.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 14),
+	})
+	DeletionFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "deleter",
+		Name:      "deletion_failures_total",
+		Help:      "Number of failed junk pin deletions.",
+	})
+	JunkQuarantined = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "deleter",
+		Name:      "junk_quarantined_total",
+		Help:      "Number of junk pins quarantined after repeated deletion failures.",
+	})
+	DeletionLag = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "deleter",
+		Name:      "deletion_lag_seconds",
+		Help:      "Time between the expiry of a pin and its actual deletion.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 16),
+	})
+)
+
+// RedisDuration is shared by all components calling Redis
+var RedisDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Subsystem: "redis",
+	Name:      "call_duration_seconds",
+	Help:      "Latency of Redis calls by command. Pipelines are labelled as pipeline.",
+	Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+}, []string{"command"})
+
+// RegisterServer registers metrics of server to the default registry
+func RegisterServer() {
+	prometheus.MustRegister(RequestDuration, PinsCreated, AttachmentBytes)
+	registerShared()
+}
+
+// RegisterDeleter registers metrics of deleter to the default registry
+func RegisterDeleter() {
+	prometheus.MustRegister(JunkBacklog, SweepDuration, DeletionFailures, JunkQuarantined, DeletionLag)
+	registerShared()
+}
+
+// registerShared registers metrics shared by server and deleter, which may run in the same process
+func registerShared() {
+	if err := prometheus.Register(RedisDuration); err != nil {
+		if _, ok := err.(prometheus.AlreadyRegisteredError); !ok {
+			panic(err)
+		}
+	}
+}
+
+// Handler returns the handler serving metrics in the default registry
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// InstrumentRedis makes c record the latency of every call it makes in RedisDuration
+func InstrumentRedis(c *redis.Client) {
+	c.WrapProcess(func(old func(redis.Cmder) error) func(redis.Cmder) error {
+		return func(cmd redis.Cmder) error {
+			start := time.Now()
+			err := old(cmd)
+			RedisDuration.WithLabelValues(cmd.Name()).Observe(time.Since(start).Seconds())
+			return err
+		}
+	})
+	c.WrapProcessPipeline(func(old func([]redis.Cmder) error) func([]redis.Cmder) error {
+		return func(cmds []redis.Cmder) error {
+			start := time.Now()
+			err := old(cmds)
+			RedisDuration.WithLabelValues("pipeline").Observe(time.Since(start).Seconds())
+			return err
+		}
+	})
+}
@@ -0,0 +1,86 @@
+// Package pinid vends generation and validation of pin IDs.
+package pinid
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/segmentio/ksuid"
+)
+
+// Scheme denotes the way a pin ID is formed
+type Scheme string
+
+const (
+	// SchemeKsuid forms pin IDs with KSUIDs, e.g. 1XJ3h7GIdeKXqGdfjWvJnPJ2MMo
+	SchemeKsuid Scheme = "ksuid"
+	// SchemeWords forms pin IDs with random dictionary words joined by WordSep, e.g. amber-falcon-river-six. IDs
+	// of this scheme are easier to read out loud, at the cost of less entropy per character
+	SchemeWords Scheme = "words"
+
+	WordSep = "-"
+	// MinWordCount and MaxWordCount bound the number of words in a word-based pin ID. The dictionary holds more
+	// than 2^10 words, so that a word-based pin ID carries at least 40 bits of entropy
+	MinWordCount     = 4
+	MaxWordCount     = 12
+	DefaultWordCount = 6
+)
+
+var dict = func() map[string]struct{} {
+	m := make(map[string]struct{}, len(words))
+	for _, w := range words {
+		m[w] = struct{}{}
+	}
+	return m
+}()
+
+// New returns a random pin ID of the given scheme. wordCnt is only respected by SchemeWords, and falls back to
+// DefaultWordCount when it is 0.
+func New(scheme Scheme, wordCnt int) (string, error) {
+	switch scheme {
+	case SchemeKsuid:
+		id, err := ksuid.NewRandom()
+		if err != nil {
+			return "", err
+		}
+		return id.String(), nil
+	case SchemeWords:
+		if wordCnt == 0 {
+			wordCnt = DefaultWordCount
+		}
+		if wordCnt < MinWordCount || wordCnt > MaxWordCount {
+			return "", fmt.Errorf("word count %d out of range [%d, %d]", wordCnt, MinWordCount, MaxWordCount)
+		}
+		ws, size := make([]string, wordCnt), big.NewInt(int64(len(words)))
+		for i := range ws {
+			// crypto/rand since pin IDs are the only secret guarding public pins
+			n, err := rand.Int(rand.Reader, size)
+			if err != nil {
+				return "", err
+			}
+			ws[i] = words[n.Int64()]
+		}
+		return strings.Join(ws, WordSep), nil
+	default:
+		return "", fmt.Errorf("unknown pin id scheme %q", scheme)
+	}
+}
+
+// Valid reports whether id is a well-formed pin ID of any supported scheme
+func Valid(id string) bool {
+	if _, err := ksuid.Parse(id); err == nil {
+		return true
+	}
+	ws := strings.Split(id, WordSep)
+	if len(ws) < MinWordCount || len(ws) > MaxWordCount {
+		return false
+	}
+	for _, w := range ws {
+		if _, ok := dict[w]; !ok {
+			return false
+		}
+	}
+	return true
+}
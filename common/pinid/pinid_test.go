@@ -0,0 +1,65 @@
+package pinid
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	tcs := []struct {
+		name    string
+		scheme  Scheme
+		wordCnt int
+		words   int
+		wantErr bool
+	}{
+		{name: "ksuid", scheme: SchemeKsuid},
+		{name: "words with default count", scheme: SchemeWords, words: DefaultWordCount},
+		{name: "words with given count", scheme: SchemeWords, wordCnt: MinWordCount, words: MinWordCount},
+		{name: "too few words", scheme: SchemeWords, wordCnt: MinWordCount - 1, wantErr: true},
+		{name: "too many words", scheme: SchemeWords, wordCnt: MaxWordCount + 1, wantErr: true},
+		{name: "unknown scheme", scheme: Scheme("uuid"), wantErr: true},
+	}
+	for _, c := range tcs {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			id, err := New(c.scheme, c.wordCnt)
+			if c.wantErr {
+				if err == nil {
+					t.Errorf("expected error but got id %s", id)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if !Valid(id) {
+				t.Errorf("generated id %s is invalid", id)
+			}
+			if c.scheme == SchemeWords {
+				if n := len(strings.Split(id, WordSep)); n != c.words {
+					t.Errorf("expected %d words but got %d in %s", c.words, n, id)
+				}
+			}
+		})
+	}
+}
+
+func TestValid(t *testing.T) {
+	tcs := map[string]bool{
+		"1XJ3h7GIdeKXqGdfjWvJnPJ2MMo":      true,
+		"amber-falcon-river-six":           true,
+		"amber-falcon-river":               false,
+		"Amber-Falcon-River-Six":           false,
+		"amber-falcon-river-qwerty":        false,
+		"amber--falcon-river-six":          false,
+		"../../etc/passwd":                 false,
+		"":                                 false,
+		"refs.1XJ3h7GIdeKXqGdfjWvJnPJ2MMo": false,
+	}
+	for id, exp := range tcs {
+		if actual := Valid(id); actual != exp {
+			t.Errorf("expected %v for %q but got %v", exp, id, actual)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package pinid
+
+// words is the dictionary to draw word-based pin IDs from. Words are short, lower-cased and distinct from each
+// other so that IDs formed by them are easy to read out loud and type back in
+var words = []string{
+	"able", "acid", "acorn", "actor", "adapt", "adobe", "agent", "agile", "aim", "air", "aisle", "alarm",
+	"album", "alert", "alley", "alpha", "amber", "amend", "amino", "ample", "angle", "ankle", "anvil", "apple",
+	"april", "apron", "arbor", "arch", "arena", "argue", "armor", "army", "aroma", "arrow", "art", "ash",
+	"aspen", "atlas", "atom", "attic", "audio", "aunt", "autumn", "avid", "awake", "award", "axis", "baby",
+	"bacon", "badge", "bagel", "baker", "balmy", "bamboo", "banana", "band", "banjo", "bank", "barn", "baron",
+	"basil", "basin", "batch", "beach", "beacon", "beam", "bean", "bear", "beard", "beaver", "bed", "beech",
+	"beef", "beetle", "bell", "belt", "bench", "berry", "bike", "birch", "bird", "bison", "black", "blade",
+	"blank", "blaze", "blend", "bliss", "block", "bloom", "blue", "blush", "board", "boat", "body", "bold",
+	"bolt", "bonus", "book", "boost", "boot", "boss", "bottle", "bounce", "bow", "bowl", "box", "brain",
+	"brass", "brave", "bread", "breeze", "brick", "bridge", "brief", "bright", "brisk", "broad", "brook",
+	"broom", "brown", "brush", "bubble", "bucket", "buddy", "budget", "buffalo", "bugle", "bulb", "bunch",
+	"bunny", "burst", "bus", "bush", "butter", "button", "buzz", "cabin", "cable", "cactus", "cadet", "cage",
+	"cake", "calm", "camel", "camera", "camp", "canal", "candle", "candy", "canoe", "canvas", "canyon", "cape",
+	"captain", "car", "carbon", "card", "cargo", "carpet", "carrot", "cart", "case", "cash", "castle", "cat",
+	"cedar", "cell", "cello", "cement", "chalk", "champ", "chant", "chapel", "charm", "chart", "cheese",
+	"cherry", "chess", "chest", "chick", "chief", "chime", "chip", "chorus", "cider", "cinema", "circle",
+	"citrus", "city", "civic", "claim", "clam", "clap", "clay", "clean", "clerk", "cliff", "climb", "clock",
+	"cloth", "cloud", "clover", "club", "coach", "coast", "coat", "cobalt", "cocoa", "coconut", "code",
+	"coffee", "coin", "comet", "comic", "coral", "cord", "corn", "cosmic", "cotton", "couch", "count", "cousin",
+	"cover", "cowboy", "crab", "craft", "crane", "crater", "crayon", "cream", "creek", "crest", "cricket",
+	"crisp", "crown", "crumb", "crystal", "cube", "cup", "curry", "curve", "cushion", "cycle", "daisy", "dance",
+	"dart", "dash", "data", "dawn", "deal", "decal", "deck", "deer", "delta", "demo", "denim", "depth",
+	"desert", "desk", "dial", "diary", "diesel", "dime", "diner", "disk", "dock", "doctor", "dollar", "dolphin",
+	"domain", "donkey", "door", "dove", "dozen", "draft", "dragon", "drama", "drawer", "dream", "dress",
+	"drift", "drill", "drink", "drum", "duck", "dune", "dusk", "dust", "dwarf", "eagle", "early", "earth",
+	"easel", "east", "echo", "edge", "eel", "effect", "egg", "eight", "elbow", "elder", "elite", "elk", "elm",
+	"ember", "emerald", "empire", "energy", "engine", "entry", "envoy", "epic", "equal", "error", "essay",
+	"euro", "event", "exact", "exam", "exit", "expert", "fabric", "face", "fact", "fairy", "falcon", "fame",
+	"family", "fancy", "farm", "fashion", "feast", "feather", "fence", "fern", "ferry", "fever", "fiber",
+	"field", "fifty", "figure", "film", "final", "finch", "fire", "first", "fish", "five", "flag", "flame",
+	"flash", "fleet", "flint", "float", "flock", "flora", "flour", "flower", "fluid", "flute", "foam", "focus",
+	"fog", "folk", "food", "forest", "fork", "fort", "forum", "fossil", "fox", "frame", "fresh", "frog",
+	"frost", "fruit", "fuel", "funny", "fury", "future", "gadget", "galaxy", "game", "garage", "garden",
+	"garlic", "gas", "gate", "gauge", "gecko", "gem", "genius", "gentle", "ghost", "giant", "ginger", "giraffe",
+	"glad", "glass", "globe", "glory", "glove", "glow", "glue", "goat", "gold", "golf", "goose", "gospel",
+	"gown", "grace", "grain", "grand", "grape", "graph", "grass", "gravel", "gravy", "great", "green", "grid",
+	"grill", "grove", "guard", "guest", "guide", "guitar", "gulf", "gust", "habit", "hair", "half", "hall",
+	"hammer", "hand", "happy", "harbor", "harp", "harvest", "hat", "hawk", "hazel", "health", "heart", "heat",
+	"hedge", "helmet", "hen", "herb", "hero", "heron", "hill", "hinge", "hobby", "hockey", "honey", "hood",
+	"hook", "hope", "horn", "horse", "host", "hotel", "hour", "house", "hub", "humble", "humor", "hunter",
+	"hut", "ice", "icon", "idea", "igloo", "image", "inch", "index", "indigo", "ink", "inlet", "input",
+	"insect", "iron", "island", "ivory", "ivy", "jacket", "jade", "jaguar", "jam", "jar", "jazz", "jeans",
+	"jelly", "jewel", "job", "jockey", "jolly", "journal", "joy", "judge", "juice", "jumbo", "jump", "jungle",
+	"junior", "jury", "kale", "kayak", "keen", "kettle", "key", "kick", "kid", "kind", "king", "kiosk", "kit",
+	"kite", "kitten", "kiwi", "knee", "knife", "knight", "knot", "koala", "label", "lace", "ladder", "lake",
+	"lamb", "lamp", "lance", "land", "lane", "laser", "latch", "lava", "lawn", "layer", "leaf", "lemon", "lens",
+	"leopard", "letter", "level", "lever", "liberty", "light", "lilac", "lily", "lime", "linen", "lion",
+	"liquid", "list", "lizard", "llama", "lobby", "lobster", "local", "locket", "lodge", "logic", "lotus",
+	"loud", "lucky", "lumber", "lunar", "lunch", "lynx", "lyric", "magic", "magnet", "maize", "major", "mango",
+	"manor", "maple", "marble", "march", "market", "mask", "mason", "meadow", "medal", "melody", "melon",
+	"memory", "mentor", "menu", "merit", "mesa", "metal", "meter", "middle", "mild", "mile", "milk", "mill",
+	"mimic", "mind", "mineral", "mint", "minute", "mirror", "mist", "mixer", "model", "modem", "moment",
+	"monkey", "month", "moon", "moose", "morning", "mosaic", "moss", "motel", "moth", "motor", "mountain",
+	"mouse", "movie", "mud", "muffin", "mule", "museum", "music", "mustard", "nail", "name", "napkin", "narrow",
+	"nation", "nature", "navy", "neck", "nectar", "needle", "neon", "nerve", "nest", "net", "never", "newt",
+	"nickel", "night", "nimble", "nine", "noble", "noodle", "normal", "north", "nose", "note", "novel",
+	"number", "nurse", "nut", "nylon", "oak", "oasis", "oat", "ocean", "octave", "odd", "office", "olive",
+	"omega", "onion", "open", "opera", "optic", "orange", "orbit", "orchid", "order", "organ", "origin",
+	"otter", "ounce", "outer", "oval", "oven", "owl", "oxygen", "oyster", "pace", "paddle", "page", "paint",
+	"palace", "palm", "panda", "panel", "panther", "paper", "parade", "park", "parrot", "party", "pasta",
+	"patch", "path", "patio", "pause", "peach", "peak", "peanut", "pear", "pebble", "pecan", "pedal", "pelican",
+	"pen", "pencil", "penny", "pepper", "piano", "pickle", "picnic", "pier", "pig", "pigeon", "pillow", "pilot",
+	"pine", "pink", "pipe", "pirate", "pitch", "pixel", "pizza", "planet", "plant", "plate", "plaza", "plum",
+	"plus", "pocket", "poem", "poet", "polar", "pond", "pony", "pool", "poppy", "porch", "port", "potato",
+	"pottery", "powder", "prairie", "prism", "prize", "proof", "proud", "pulse", "puma", "pumpkin", "pupil",
+	"puppy", "purple", "puzzle", "pyramid", "quail", "quake", "quart", "queen", "quest", "quick", "quiet",
+	"quill", "quilt", "quiz", "quote", "rabbit", "raccoon", "race", "radar", "radio", "raft", "rain", "raisin",
+	"rally", "ranch", "range", "rapid", "raven", "razor", "ready", "recipe", "record", "reef", "relay", "relic",
+	"remedy", "rescue", "resort", "rhino", "ribbon", "rice", "ride", "ridge", "rifle", "ring", "ripple",
+	"river", "road", "robin", "robot", "rocket", "rodeo", "roof", "room", "root", "rope", "rose", "rotor",
+	"round", "route", "royal", "ruby", "rug", "ruler", "rumor", "rural", "rust", "saddle", "safari", "saga",
+	"sail", "salad", "salmon", "salt", "sample", "sand", "satin", "sauce", "sausage", "scale", "scarf", "scene",
+	"school", "scout", "screen", "script", "sea", "seal", "season", "secret", "seed", "shadow", "shark",
+	"sheep", "shelf", "shell", "sheriff", "shield", "shirt", "shoe", "shore", "shovel", "shrimp", "sierra",
+	"signal", "silk", "silver", "simple", "siren", "sister", "six", "sketch", "ski", "sky", "slate", "sled",
+	"slope", "smile", "smoke", "snack", "snail", "snake", "snow", "soap", "soccer", "sock", "soda", "sofa",
+	"soft", "solar", "soldier", "sonic", "sound", "soup", "south", "space", "spark", "sphere", "spice",
+	"spider", "spiral", "spoon", "sport", "spray", "spring", "sprout", "spruce", "square", "squid", "stable",
+	"stadium", "staff", "stage", "stamp", "star", "station", "steam", "steel", "stem", "step", "stereo",
+	"stone", "stool", "storm", "story", "stove", "straw", "stream", "street", "studio", "sugar", "suit",
+	"summer", "summit", "sun", "sunset", "super", "surf", "swan", "sweater", "swift", "switch", "sword",
+	"symbol", "syrup", "system", "table", "tablet", "taco", "tail", "talent", "tango", "tank", "tape", "target",
+	"taxi", "tea", "teacher", "team", "temple", "tennis", "tent", "thirty", "thread", "three", "thunder",
+	"ticket", "tide", "tiger", "timber", "tin", "toast", "today", "token", "tomato", "tone", "topaz", "torch",
+	"tortoise", "total", "tower", "town", "toy", "track", "tractor", "trade", "trail", "train", "tree", "trend",
+	"tribe", "trick", "trio", "trophy", "tropic", "truck", "trumpet", "trunk", "tulip", "tuna", "tundra",
+	"tunnel", "turkey", "turtle", "tutor", "twelve", "twenty", "twin", "ultra", "umbrella", "uncle", "union",
+	"unit", "universe", "upper", "urban", "usual", "vacuum", "valley", "value", "valve", "vanilla", "vapor",
+	"velvet", "vendor", "venus", "verse", "vessel", "video", "view", "villa", "village", "vine", "vinyl",
+	"violet", "violin", "virtue", "visa", "vision", "visit", "vital", "vivid", "vocal", "voice", "volcano",
+	"volume", "voyage", "wafer", "wagon", "waiter", "walnut", "walrus", "wand", "water", "wave", "wax",
+	"wealth", "weasel", "weather", "web", "wedge", "whale", "wheat", "wheel", "whisper", "white", "wide",
+	"widget", "wild", "willow", "wind", "window", "wine", "wing", "winner", "winter", "wire", "wisdom",
+	"wizard", "wolf", "wonder", "wood", "wool", "word", "world", "worm", "wrist", "yacht", "yak", "yard",
+	"yarn", "year", "yellow", "yoga", "yogurt", "young", "zebra", "zero", "zest", "zigzag", "zinc", "zipper",
+	"zone", "zoo",
+}
@@ -0,0 +1,115 @@
+// Package pow vends hashcash-like proof-of-work challenges.
+//
+// A challenge is a string in format of `v1.<nonce>.<issued at in unix seconds>.<difficulty>.<signature>`, where
+// signature is the HMAC-SHA256 of the rest of the challenge along with the requester's IP address, so that the
+// challenge is bound to both time and requester without server side state. A solution is any string s such that
+// SHA256(challenge + ":" + s) has at least difficulty leading zero bits.
+package pow
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	version   = "v1"
+	sep       = "."
+	nonceSize = 16
+	// MaxDifficulty caps difficulty so that challenges stay solvable by browsers
+	MaxDifficulty = 32
+)
+
+// Challenge is the decoded form of a challenge string
+type Challenge struct {
+	Nonce      string
+	IssuedAt   time.Time
+	Difficulty int
+}
+
+// Issue returns a challenge of the given difficulty for requester at ip, signed with key
+func Issue(key []byte, ip string, difficulty int, now time.Time) (string, error) {
+	if difficulty < 0 || difficulty > MaxDifficulty {
+		return "", fmt.Errorf("difficulty %d out of range [0, %d]", difficulty, MaxDifficulty)
+	}
+	b := make([]byte, nonceSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	body := strings.Join([]string{
+		version,
+		hex.EncodeToString(b),
+		strconv.FormatInt(now.Unix(), 10),
+		strconv.Itoa(difficulty),
+	}, sep)
+	return body + sep + sign(key, body, ip), nil
+}
+
+// Verify checks that challenge was issued with key to requester at ip no longer than ttl ago, and that solution
+// solves it
+func Verify(key []byte, challenge, solution, ip string, ttl time.Duration, now time.Time) (*Challenge, error) {
+	i := strings.LastIndex(challenge, sep)
+	if i < 0 {
+		return nil, fmt.Errorf("malformed challenge")
+	}
+	body, sig := challenge[:i], challenge[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(sign(key, body, ip))) {
+		return nil, fmt.Errorf("invalid challenge signature")
+	}
+	parts := strings.Split(body, sep)
+	if len(parts) != 4 || parts[0] != version {
+		return nil, fmt.Errorf("malformed challenge")
+	}
+	issuedAt, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("malformed challenge issue time: %w", err)
+	}
+	difficulty, err := strconv.Atoi(parts[3])
+	if err != nil {
+		return nil, fmt.Errorf("malformed challenge difficulty: %w", err)
+	}
+	c := &Challenge{Nonce: parts[1], IssuedAt: time.Unix(issuedAt, 0), Difficulty: difficulty}
+	if now.Sub(c.IssuedAt) > ttl || c.IssuedAt.After(now) {
+		return nil, fmt.Errorf("challenge expired")
+	}
+	if !Solves(challenge, solution, difficulty) {
+		return nil, fmt.Errorf("wrong solution")
+	}
+	return c, nil
+}
+
+// Solves reports whether solution solves challenge of the given difficulty
+func Solves(challenge, solution string, difficulty int) bool {
+	sum := sha256.Sum256([]byte(challenge + ":" + solution))
+	zeros := 0
+	for _, b := range sum {
+		zeros += bits.LeadingZeros8(b)
+		if b != 0 {
+			break
+		}
+	}
+	return zeros >= difficulty
+}
+
+// Solve brute-forces a solution of challenge of the given difficulty
+func Solve(challenge string, difficulty int) string {
+	for i := 0; ; i++ {
+		s := strconv.Itoa(i)
+		if Solves(challenge, s, difficulty) {
+			return s
+		}
+	}
+}
+
+func sign(key []byte, body, ip string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(body + "|" + ip))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,53 @@
+package pow
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	key, ip, ttl := []byte("key"), "203.0.113.7", time.Minute
+	now := time.Now()
+	const difficulty = 8
+	c, err := Issue(key, ip, difficulty, now)
+	if err != nil {
+		t.Fatalf("error issuing challenge: %v", err)
+	}
+	solution := Solve(c, difficulty)
+	tcs := []struct {
+		name      string
+		key       []byte
+		challenge string
+		solution  string
+		ip        string
+		now       time.Time
+		ok        bool
+	}{
+		{name: "solved", key: key, challenge: c, solution: solution, ip: ip, now: now, ok: true},
+		{name: "wrong key", key: []byte("yek"), challenge: c, solution: solution, ip: ip, now: now},
+		{name: "wrong ip", key: key, challenge: c, solution: solution, ip: "203.0.113.8", now: now},
+		{name: "expired", key: key, challenge: c, solution: solution, ip: ip, now: now.Add(2 * ttl)},
+		{name: "tampered", key: key, challenge: "v1.00.0.0" + c[len(c)-44:], solution: solution, ip: ip, now: now},
+		{name: "malformed", key: key, challenge: "garbage", solution: solution, ip: ip, now: now},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Verify(tc.key, tc.challenge, tc.solution, tc.ip, ttl, tc.now)
+			if tc.ok && err != nil {
+				t.Errorf("expected challenge verified but got %v", err)
+			} else if !tc.ok && err == nil {
+				t.Errorf("expected verification failure but got none")
+			}
+		})
+	}
+}
+
+func TestSolves(t *testing.T) {
+	c := "challenge"
+	for _, d := range []int{0, 4, 12} {
+		if s := Solve(c, d); !Solves(c, s, d) {
+			t.Errorf("solution %s doesn't solve challenge of difficulty %d", s, d)
+		}
+	}
+}
@@ -11,24 +11,72 @@ const (
 	EnvRedisPasswd                 = "REDIS_PASSWD"
 	EnvRedisDB                     = "REDIS_DB"
 	EnvPinStoreJunkFetcherPoolSize = "PIN_STORE_JUNK_FETCHER_POOL_SIZE"
+	EnvFileStoreRoot               = "PIN_FILE_STORE_ROOT"
+	EnvPinStore                    = "PIN_STORE"
+	EnvFileStore                   = "PIN_FILE_STORE"
+	EnvDataDir                     = "PIN_DATA_DIR"
+	EnvSQLDriver                   = "PIN_SQL_DRIVER"
+	EnvSQLDSN                      = "PIN_SQL_DSN"
 	// server
 	EnvAppHost                  = "PIN_HOST"
 	EnvAppPort                  = "PIN_PORT"
+	EnvMetricsPort              = "PIN_METRICS_PORT"
 	EnvReqBodySizeMaxByte       = "PIN_REQ_BODY_SIZE_MAX_BYTE"
 	EnvPinTitleSizeMaxByte      = "PIN_TITLE_SIZE_MAX_BYTE"
 	EnvPinNoteSizeMaxByte       = "PIN_NOTE_SIZE_MAX_BYTE"
 	EnvPinAttachmentSizeMaxByte = "PIN_ATTACHMENT_SIZE_MAX_BYTE"
 	EnvPinAttachmentCntMax      = "PIN_ATTACHMENT_COUNT_MAX"
+	EnvAppBaseURL               = "PIN_BASE_URL"
+	EnvPinIDWordCount           = "PIN_ID_WORD_COUNT"
+	EnvViewNoticeThrottle       = "PIN_VIEW_NOTICE_THROTTLE"
+	EnvSMTPAddr                 = "PIN_SMTP_ADDR"
+	EnvSMTPUser                 = "PIN_SMTP_USER"
+	EnvSMTPPasswd               = "PIN_SMTP_PASSWD"
+	EnvMailFrom                 = "PIN_MAIL_FROM"
+	EnvAccessLogSalt            = "PIN_ACCESS_LOG_SALT"
+	EnvTrustProxy               = "PIN_TRUST_PROXY"
+	EnvHSTS                     = "PIN_HSTS"
+	EnvReadTimeout              = "PIN_READ_TIMEOUT"
+	EnvWriteTimeout             = "PIN_WRITE_TIMEOUT"
+	EnvPreStopDelay             = "PIN_PRE_STOP_DELAY"
+	EnvShutdownTimeout          = "PIN_SHUTDOWN_TIMEOUT"
+	EnvEmbeddedDeleter          = "PIN_EMBEDDED_DELETER"
+	// rate limits are numbers of requests allowed per window, where 0 means unlimited
+	EnvRateLimitWindow          = "PIN_RATE_LIMIT_WINDOW"
+	EnvRateLimitAnonymous       = "PIN_RATE_LIMIT_ANONYMOUS"
+	EnvRateLimitUser            = "PIN_RATE_LIMIT_USER"
+	EnvRateLimitToken           = "PIN_RATE_LIMIT_TOKEN"
+	EnvRateLimitCreateAnonymous = "PIN_RATE_LIMIT_CREATE_ANONYMOUS"
+	EnvRateLimitCreateUser      = "PIN_RATE_LIMIT_CREATE_USER"
+	EnvRateLimitCreateToken     = "PIN_RATE_LIMIT_CREATE_TOKEN"
+	// proof-of-work challenges for anonymous pin creation
+	EnvPoWEnabled       = "PIN_POW_ENABLED"
+	EnvPoWKey           = "PIN_POW_KEY"
+	EnvPoWDifficulty    = "PIN_POW_DIFFICULTY"
+	EnvPoWMaxDifficulty = "PIN_POW_MAX_DIFFICULTY"
+	EnvPoWLoadThreshold = "PIN_POW_LOAD_THRESHOLD"
+	EnvPoWChallengeTTL  = "PIN_POW_CHALLENGE_TTL"
 	// deleter
 	EnvPinDeleterLocalCacheSize   = "PIN_DELETER_LOCAL_CACHE_SIZE"
 	EnvDeleterSweepFreq           = "PIN_DELETER_SWEEP_FREQ"
 	EnvDeleterMaxSweepLoad        = "PIN_DELETER_MAX_SWEEP_LOAD"
 	EnvDeleterExecutorPoolSize    = "PIN_DELETER_EXEC_POOL_SIZE"
 	EnvDeleterWIPCacheEntryExpiry = "PIN_DELETER_WIP_CACHE_ENTRY_EXPIRY"
+	EnvDeleterPort                = "PIN_DELETER_PORT"
+	EnvDeleterQueueSize           = "PIN_DELETER_QUEUE_SIZE"
+	EnvDeleterShutdownTimeout     = "PIN_DELETER_SHUTDOWN_TIMEOUT"
+	EnvDeleterLeaseTTL            = "PIN_DELETER_LEASE_TTL"
+	EnvDeleterMaxAttempts         = "PIN_DELETER_MAX_ATTEMPTS"
+	EnvDeleterRetryBackoff        = "PIN_DELETER_RETRY_BACKOFF"
+	EnvDeleterReconcileGrace      = "PIN_DELETER_RECONCILE_GRACE"
+	EnvDeleterEvents              = "PIN_DELETER_EVENTS"
+	EnvDeleterEventSweepFreq      = "PIN_DELETER_EVENT_SWEEP_FREQ"
 	EnvSessAuthNKey               = "PIN_SESSION_AUTH_N_KEY"
 	EnvSessEncryptKey             = "PIN_SESSION_ENCRYPTION_KEY"
+	EnvSessCookieSecure           = "PIN_SESSION_COOKIE_SECURE"
 	// error messages ----------------------------------------------------
 	ErrMsgRequestBodyTooLarge = "request body too large"
 	// logging ----------------------------------------------------
-	LogFieldFuncName = "funcName"
+	LogFieldFuncName  = "funcName"
+	LogFieldRequestID = "requestID"
 )
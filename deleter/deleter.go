@@ -0,0 +1,540 @@
+// Package deleter disposes of junk pins, aka expired or burnt ones, along with their attachments. It runs as a
+// standalone worker, or embedded in the server process alongside stores which cannot be shared across processes.
+package deleter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bluele/gcache"
+	"github.com/segmentio/ksuid"
+	"github.com/spf13/viper"
+	"wuyrush.io/pin/common/logging"
+	"wuyrush.io/pin/common/metrics"
+	cst "wuyrush.io/pin/constants"
+	pe "wuyrush.io/pin/errors"
+	md "wuyrush.io/pin/models"
+	st "wuyrush.io/pin/stores"
+	"wuyrush.io/pin/webhook"
+)
+
+// Deleter sweeps junk pins from PinStore periodically and deletes them along with their attachments in FileStore.
+type Deleter struct {
+	FS st.FileStore
+	PS st.PinStore
+	NT *webhook.Notifier
+	// JW streams junk pins as they turn into junk; nil unless deleter runs in event mode
+	JW st.JunkWatcher
+	// Once is set if deleter sweeps only once
+	Once bool
+	// Rep summarizes the run. Sizes of deleted attachments are measured only if Measure is set
+	Rep     *Report
+	Measure bool
+
+	wipCache gcache.Cache
+	// id identifies the deleter replica as holder of leases on junk pins
+	id       string
+	leaseTTL time.Duration
+	// junk pins failed to be deleted maxAttempts times are quarantined. Attempts are spaced out by exponential
+	// backoff starting at retryBackoff
+	maxAttempts  int
+	retryBackoff time.Duration
+	// sweepFreq is the period between sweeps of junk pins
+	sweepFreq time.Duration
+	// execPoolSize is the number of workers deleting junk pins
+	execPoolSize int
+	// unix time in nanoseconds of deleter startup and the last successful sweep, accessed atomically
+	startTime, lastSweep int64
+}
+
+// deleter is deemed unhealthy if it had not swept successfully for this many sweep periods
+const maxMissedSweeps = 3
+
+// New returns a Deleter of junk pins in ps and their attachments in fs, configured by env vars. It runs in event
+// mode if configured so and ps is able to watch junk pins
+func New(ps st.PinStore, fs st.FileStore, nt *webhook.Notifier) *Deleter {
+	leaseTTL := viper.GetDuration(cst.EnvDeleterLeaseTTL)
+	if leaseTTL <= 0 {
+		leaseTTL = defaultLeaseTTL
+	}
+	maxAttempts := viper.GetInt(cst.EnvDeleterMaxAttempts)
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+	retryBackoff := viper.GetDuration(cst.EnvDeleterRetryBackoff)
+	if retryBackoff <= 0 {
+		retryBackoff = defaultRetryBackoff
+	}
+	cacheSize := viper.GetInt(cst.EnvPinDeleterLocalCacheSize)
+	if cacheSize <= 0 {
+		cacheSize = defaultLocalCacheSize
+	}
+	sweepFreq := viper.GetDuration(cst.EnvDeleterSweepFreq)
+	if sweepFreq <= 0 {
+		sweepFreq = defaultSweepFreq
+	}
+	execPoolSize := viper.GetInt(cst.EnvDeleterExecutorPoolSize)
+	if execPoolSize <= 0 {
+		execPoolSize = defaultExecPoolSize
+	}
+	d := &Deleter{
+		FS:           fs,
+		PS:           ps,
+		NT:           nt,
+		Rep:          NewReport(false),
+		wipCache:     gcache.New(cacheSize).LRU().Build(),
+		id:           replicaID(),
+		leaseTTL:     leaseTTL,
+		maxAttempts:  maxAttempts,
+		retryBackoff: retryBackoff,
+		sweepFreq:    sweepFreq,
+		execPoolSize: execPoolSize,
+		startTime:    time.Now().UnixNano(),
+	}
+	// in event mode junk pins are disposed of as they turn into junk, leaving sweeps a slow safety net for
+	// events missed while deleter was disconnected from PinStore
+	if jw, ok := ps.(st.JunkWatcher); ok && viper.GetBool(cst.EnvDeleterEvents) {
+		d.JW = jw
+		d.sweepFreq = viper.GetDuration(cst.EnvDeleterEventSweepFreq)
+		if d.sweepFreq <= 0 {
+			d.sweepFreq = defaultEventSweepFreq
+		}
+	}
+	return d
+}
+
+// ID identifies the deleter replica
+func (d *Deleter) ID() string {
+	return d.id
+}
+
+// HandleHealthz reports the time of the last successful sweep, along with 503 if deleter had missed too many
+// sweeps in a row
+func (d *Deleter) HandleHealthz(w http.ResponseWriter, r *http.Request) {
+	res := struct {
+		LastSweep *time.Time `json:"lastSweep"`
+	}{}
+	since := atomic.LoadInt64(&d.startTime)
+	if ls := atomic.LoadInt64(&d.lastSweep); ls > 0 {
+		t := time.Unix(0, ls).UTC()
+		res.LastSweep, since = &t, ls
+	}
+	code := http.StatusOK
+	if time.Since(time.Unix(0, since)) > maxMissedSweeps*d.sweepFreq {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, res)
+}
+
+// HandleReadyz reports whether dependencies of deleter are healthy, along with 503 if any of them is not
+func (d *Deleter) HandleReadyz(w http.ResponseWriter, r *http.Request) {
+	code, res := http.StatusOK, map[string]string{"pinStore": "ok", "fileStore": "ok"}
+	if err := d.PS.Ping(r.Context()); err != nil {
+		code, res["pinStore"] = http.StatusServiceUnavailable, err.Error()
+	}
+	if err := d.FS.Ping(r.Context()); err != nil {
+		code, res["fileStore"] = http.StatusServiceUnavailable, err.Error()
+	}
+	writeJSON(w, code, res)
+}
+
+func writeJSON(w http.ResponseWriter, code int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		logging.WithFuncName().WithError(err).Error("error writing JSON response")
+	}
+}
+
+// job is a junk pin queued for disposal
+type job struct {
+	// ctx is the context of the sweep loading the junk pin. It lends its sweep ID to log entries only
+	ctx   context.Context
+	jk    *md.Junk
+	sweep *sweepState
+}
+
+// sweepState tracks disposal of junk pins loaded by a sweep, or reported by an event
+type sweepState struct {
+	wg sync.WaitGroup
+	// numbers of junk pins deleted and failed to be deleted, accessed atomically
+	deleted, failed int64
+}
+
+const (
+	defaultShutdownTimeout = 30 * time.Second
+	defaultLocalCacheSize  = 1024
+	defaultSweepFreq       = time.Minute
+	defaultExecPoolSize    = 4
+	// leases on junk pins are renewed every third of their TTL while deleting them
+	defaultLeaseTTL     = 5 * time.Minute
+	defaultMaxAttempts  = 5
+	defaultRetryBackoff = time.Minute
+	maxRetryBackoff     = time.Hour
+	// sweeps are merely a safety net in event mode
+	defaultEventSweepFreq = 15 * time.Minute
+)
+
+// replicaID returns a unique ID of the deleter replica, prefixed with host name for ease of troubleshooting
+func replicaID() string {
+	id := ksuid.New().String()
+	if host, err := os.Hostname(); err == nil {
+		return fmt.Sprintf("%s-%s", host, id)
+	}
+	return id
+}
+
+// Run sweeps junk pins periodically till ctx is cancelled, along with disposing of junk pins as they turn into
+// junk in event mode. In one-shot mode, Run sweeps once and lasts till the sweep completes. Junk pins are queued
+// in a bounded queue consumed by a fixed pool of workers; sweeps block when the queue is full. Upon cancellation,
+// Run stops sweeping, lets workers finish in-flight deletions and abandons queued ones, waiting up to the
+// configured shutdown timeout. Abandoning a deletion is safe since pins are deregistered only after all their
+// data is gone, hence get picked up again by following sweeps
+func (d *Deleter) Run(ctx context.Context) *pe.PinErr {
+	clog := logging.WithFuncName()
+	freq := d.sweepFreq
+	// junk pins never arrive from a nil channel, hence loop merely sweeps unless in event mode
+	var events <-chan *md.Junk
+	if d.JW != nil && !d.Once {
+		var err *pe.PinErr
+		if events, err = d.JW.Watch(ctx); err != nil {
+			return err
+		}
+		clog.WithField("sweepFrequency", freq).Info("deleter runs in event mode")
+	}
+	execPoolSize := d.execPoolSize
+	queueSize := viper.GetInt(cst.EnvDeleterQueueSize)
+	if queueSize <= 0 {
+		queueSize = execPoolSize
+	}
+	shutdownTimeout := viper.GetDuration(cst.EnvDeleterShutdownTimeout)
+	if shutdownTimeout <= 0 {
+		shutdownTimeout = defaultShutdownTimeout
+	}
+	maxLoad := viper.GetInt(cst.EnvDeleterMaxSweepLoad)
+	queue := make(chan *job, queueSize)
+	var workers sync.WaitGroup
+	workers.Add(execPoolSize)
+	for i := 0; i < execPoolSize; i++ {
+		go func() {
+			defer workers.Done()
+			for jb := range queue {
+				d.work(ctx, jb)
+			}
+		}()
+	}
+	var err *pe.PinErr
+	if d.Once {
+		err = d.sweep(ctx, queue, maxLoad)
+	} else {
+		d.loop(ctx, queue, events, freq, maxLoad)
+	}
+	close(queue)
+	// wait for workers along with pending webhook deliveries
+	done := make(chan struct{})
+	go func() {
+		workers.Wait()
+		d.NT.Wait()
+		close(done)
+	}()
+	// a one-shot run waits for its deletions to complete unless cancelled
+	if d.Once {
+		select {
+		case <-done:
+		case <-ctx.Done():
+		}
+	}
+	select {
+	case <-done:
+		clog.Info("deleter stopped")
+	case <-time.After(shutdownTimeout):
+		clog.WithField("shutdownTimeout", shutdownTimeout).Warn("abandoned in-flight deletions upon shutdown timeout")
+	}
+	return err
+}
+
+// loop sweeps junk pins every freq, and queues junk pins arriving from events as they come, till ctx is
+// cancelled. Failed sweeps are retried upon the next tick, and show up in healthz once they keep failing
+func (d *Deleter) loop(ctx context.Context, queue chan<- *job, events <-chan *md.Junk, freq time.Duration,
+	maxLoad int) {
+	tkr := time.NewTicker(freq)
+	defer tkr.Stop()
+	for {
+		select {
+		case <-tkr.C:
+			// sweep logs its own failures
+			d.sweep(ctx, queue, maxLoad)
+		case jk, ok := <-events:
+			// the channel closes upon cancellation of ctx only
+			if !ok {
+				events = nil
+				continue
+			}
+			d.dispatch(ctx, queue, jk)
+		case <-ctx.Done():
+			logging.WithFuncName().Info("deleter is stopping")
+			return
+		}
+	}
+}
+
+// sweep loads up to maxLoad junk pins and queues them for disposal. It stops queueing once ctx is cancelled
+func (d *Deleter) sweep(ctx context.Context, queue chan<- *job, maxLoad int) *pe.PinErr {
+	// log entries of a sweep are tied up with a sweep ID, much like server requests. The sweep context is not
+	// derived from ctx so that in-flight deletions can finish upon shutdown
+	sctx := logging.NewContext(context.Background(), ksuid.New().String())
+	clog := logging.WithFuncName().WithContext(sctx)
+	start := time.Now()
+	if n, err := d.PS.JunkCount(sctx); err != nil {
+		clog.WithError(err).Error("error counting junk pins")
+	} else {
+		metrics.JunkBacklog.Set(float64(n))
+	}
+	jks, err := d.Load(sctx, maxLoad)
+	if err != nil {
+		clog.WithError(err).Error("error loading junk pins")
+		return err
+	}
+	clog.WithField("count", len(jks)).Debug("junk pins loaded")
+	atomic.AddInt64(&d.Rep.Junk, int64(len(jks)))
+	ss := &sweepState{}
+	for i, jk := range jks {
+		ss.wg.Add(1)
+		select {
+		case queue <- &job{ctx: sctx, jk: jk, sweep: ss}:
+		case <-ctx.Done():
+			ss.wg.Done()
+			// release pins not queued so that they get picked up again
+			for _, jk := range jks[i:] {
+				d.release(sctx, jk.PinID)
+			}
+			clog.WithField("count", len(jks)-i).Info("abandoned unqueued junk pins upon shutdown")
+			return nil
+		}
+	}
+	// a sweep lasts till all its junk pins are disposed of. It succeeds unless every deletion of it fails, so that
+	// healthz turns red once workers keep failing
+	go func() {
+		ss.wg.Wait()
+		metrics.SweepDuration.Observe(time.Since(start).Seconds())
+		if atomic.LoadInt64(&ss.failed) == 0 || atomic.LoadInt64(&ss.deleted) > 0 {
+			atomic.StoreInt64(&d.lastSweep, time.Now().UnixNano())
+		}
+	}()
+	return nil
+}
+
+// dispatch claims junk pin jk reported by event and queues it for disposal. Failures are left to sweeps
+func (d *Deleter) dispatch(ctx context.Context, queue chan<- *job, jk *md.Junk) {
+	// log entries of an event are tied up with an event ID, much like sweeps
+	ectx := logging.NewContext(context.Background(), ksuid.New().String())
+	clog := logging.WithFuncName().WithContext(ectx).WithField("pinID", jk.PinID)
+	jks, err := d.claim(ectx, []*md.Junk{jk})
+	if err != nil {
+		clog.WithError(err).Error("error claiming junk pin reported by event")
+		return
+	}
+	if len(jks) == 0 {
+		return
+	}
+	clog.Debug("junk pin reported by event")
+	ss := &sweepState{}
+	ss.wg.Add(1)
+	select {
+	case queue <- &job{ctx: ectx, jk: jk, sweep: ss}:
+	case <-ctx.Done():
+		d.release(ectx, jk.PinID)
+	}
+}
+
+// work disposes of the junk pin of jb, unless ctx had been cancelled by then
+func (d *Deleter) work(ctx context.Context, jb *job) {
+	defer jb.sweep.wg.Done()
+	clog := logging.WithFuncName().WithContext(jb.ctx).WithField("junk", jb.jk)
+	if ctx.Err() != nil {
+		d.release(jb.ctx, jb.jk.PinID)
+		clog.Debug("abandoned queued junk pin upon shutdown")
+		return
+	}
+	var size int64
+	if d.Measure {
+		size = d.size(jb.ctx, jb.jk)
+	}
+	stopRenew := d.renew(jb.ctx, jb.jk.PinID)
+	err := d.Delete(jb.ctx, jb.jk)
+	stopRenew()
+	if err != nil {
+		metrics.DeletionFailures.Inc()
+		atomic.AddInt64(&d.Rep.Failed, 1)
+		atomic.AddInt64(&jb.sweep.failed, 1)
+		clog.WithError(err).Error("error deleting junk pin")
+		d.fail(jb.ctx, jb.jk, err)
+		return
+	}
+	metrics.DeletionLag.Observe(time.Since(jb.jk.Expiry).Seconds())
+	atomic.AddInt64(&d.Rep.Deleted, 1)
+	atomic.AddInt64(&jb.sweep.deleted, 1)
+	atomic.AddInt64(&d.Rep.Files, int64(len(jb.jk.FileRefs)))
+	atomic.AddInt64(&d.Rep.Bytes, size)
+	clog.Debug("successfully deleting junk pin")
+	d.NT.Notify(jb.ctx, jb.jk.OwnerID, webhook.EventPinExpired, jb.jk.PinID)
+}
+
+// renew keeps renewing the lease on junk pin till the returned function is called, so that deletions outliving
+// leaseTTL are never taken over by other deleter replicas. The returned function waits for renewal to stop
+func (d *Deleter) renew(ctx context.Context, pinID string) func() {
+	clog := logging.WithFuncName().WithContext(ctx).WithField("pinID", pinID)
+	stop, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		tkr := time.NewTicker(d.leaseTTL / 3)
+		defer tkr.Stop()
+		for {
+			select {
+			case <-tkr.C:
+				ok, err := d.PS.Renew(ctx, pinID, d.id, d.leaseTTL)
+				if err != nil {
+					clog.WithError(err).Warn("error renewing lease on junk pin. Retrying upon the next tick")
+				} else if !ok {
+					clog.Warn("lost lease on junk pin, which another deleter may be deleting as well")
+					return
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// Load loads up to max junk pins from PinStore for cleanup, and claims those not being worked on by any deleter.
+// It loads all junk pins available in PinStore if max == 0.
+func (d *Deleter) Load(ctx context.Context, max int) ([]*md.Junk, *pe.PinErr) {
+	clog := logging.WithFuncName().WithContext(ctx)
+	// get stale pin data with PinStore
+	jks, err := d.PS.Junk(ctx, max)
+	if err != nil {
+		clog.WithError(err).Error("error loading junk pins from PinStore")
+		return nil, err
+	}
+	clog.Debug("successfully loaded junk pins from PinStore")
+	return d.claim(ctx, jks)
+}
+
+// claim claims junk pins in jks which are not being worked on by any deleter, and returns the claimed ones
+func (d *Deleter) claim(ctx context.Context, jks []*md.Junk) ([]*md.Junk, *pe.PinErr) {
+	clog := logging.WithFuncName().WithContext(ctx)
+	// query local cache to filter out pins which are already WIP
+	newJks := []*md.Junk{}
+	for _, jk := range jks {
+		if _, err := d.wipCache.Get(jk.PinID); err != nil {
+			if err == gcache.KeyNotFoundError {
+				newJks = append(newJks, jk)
+			} else {
+				msg := "error getting pin id from local cache"
+				clog.WithError(err).Error(msg)
+				return nil, pe.ErrServiceFailure(msg).WithCause(err)
+			}
+		}
+	}
+	// claim these pins so that other deleter replicas leave them alone
+	claimed := make([]*md.Junk, 0, len(newJks))
+	for _, jk := range newJks {
+		ok, err := d.PS.Claim(ctx, jk.PinID, d.id, d.leaseTTL)
+		if err != nil {
+			// the pin is picked up again by following sweeps
+			clog.WithError(err).WithField("pinID", jk.PinID).Error("error claiming junk pin. Skipping")
+			continue
+		}
+		if !ok {
+			clog.WithField("pinID", jk.PinID).Debug("junk pin claimed by another deleter. Skipping")
+			continue
+		}
+		claimed = append(claimed, jk)
+	}
+	// cache the ids of these pins in WIP cache in best-effort manner - pin id which we failed to set in cache
+	// will be picked up by deleter in its next sweep
+	exp := viper.GetDuration(cst.EnvDeleterWIPCacheEntryExpiry)
+	for _, jk := range claimed {
+		if err := d.wipCache.SetWithExpire(jk.PinID, struct{}{}, exp); err != nil {
+			clog.WithError(err).Errorf("error keying pin id %s in local cache", jk.PinID)
+		}
+	}
+	return claimed, nil
+}
+
+// fail records the failed attempt to delete junk pin, which is then retried with exponential backoff, or
+// quarantined once it fails too many times
+func (d *Deleter) fail(ctx context.Context, jk *md.Junk, cause error) {
+	clog := logging.WithFuncName().WithContext(ctx).WithField("pinID", jk.PinID)
+	now := time.Now()
+	f := &md.JunkFailure{
+		PinID:       jk.PinID,
+		Attempts:    jk.Attempts + 1,
+		LastErr:     cause.Error(),
+		LastAttempt: now.UTC(),
+		Expiry:      jk.Expiry,
+	}
+	quarantine := f.Attempts >= d.maxAttempts
+	if err := d.PS.Fail(ctx, f, now.Add(d.backoff(f.Attempts)), quarantine); err != nil {
+		clog.WithError(err).Error("error recording junk pin failure. It is retried as is")
+		return
+	}
+	if quarantine {
+		metrics.JunkQuarantined.Inc()
+		atomic.AddInt64(&d.Rep.Quarantined, 1)
+		clog.WithField("attempts", f.Attempts).Warn("junk pin quarantined after repeated failures")
+	}
+	// the lease is no longer needed since backoff spaces out the attempts
+	d.release(ctx, jk.PinID)
+}
+
+// backoff returns the delay before the next attempt to delete a junk pin which had failed attempts times
+func (d *Deleter) backoff(attempts int) time.Duration {
+	b := d.retryBackoff
+	for i := 1; i < attempts && b < maxRetryBackoff; i++ {
+		b *= 2
+	}
+	if b > maxRetryBackoff {
+		b = maxRetryBackoff
+	}
+	return b
+}
+
+// release marks junk pin as no longer WIP in this deleter, and gives up the lease on it
+func (d *Deleter) release(ctx context.Context, pinID string) {
+	d.wipCache.Remove(pinID)
+	if err := d.PS.Release(ctx, pinID, d.id); err != nil {
+		logging.WithFuncName().WithContext(ctx).WithError(err).WithField("pinID", pinID).
+			Warn("error releasing junk pin. It stays claimed till the lease runs out")
+	}
+}
+
+func (d *Deleter) Delete(ctx context.Context, j *md.Junk) *pe.PinErr {
+	clog := logging.WithFuncName().WithContext(ctx).WithField("pinID", j.PinID)
+	// remove all pin attachment files from FileStore. Attachments are removed one by one since pins have few
+	// of them, which also ensures no removal outlives Delete
+	for _, ref := range j.FileRefs {
+		if err := d.FS.Delete(ctx, ref); err != nil {
+			clog.WithError(err).WithField("ref", ref).Error("error deleting pin attachment with FileStore")
+			return err
+		}
+	}
+	// At this point ALL the pin's attachments are cleaned up; Deregister pin from PinStore.
+	if err := d.PS.Deregister(ctx, j.PinID); err != nil {
+		clog.WithError(err).Error("error deregistering pin from PinStore")
+		return err
+	}
+	// remove corresponding pin id from local cache and give up the lease
+	d.release(ctx, j.PinID)
+	return nil
+}
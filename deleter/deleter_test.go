@@ -0,0 +1,221 @@
+package deleter
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	cst "wuyrush.io/pin/constants"
+	pe "wuyrush.io/pin/errors"
+	md "wuyrush.io/pin/models"
+	st "wuyrush.io/pin/stores"
+	"wuyrush.io/pin/webhook"
+)
+
+const attachment = "content of attachment"
+
+// newTestDeleter returns a Deleter of the given junk pins in a memory store, each of which has an attachment in fs
+func newTestDeleter(t *testing.T, fs st.FileStore, ids ...string) (*Deleter, *st.MemoryStore) {
+	ctx := context.Background()
+	viper.Set(cst.EnvPinAttachmentSizeMaxByte, 1<<10)
+	ps := st.NewMemoryStore()
+	for _, id := range ids {
+		ref := fs.Ref(id, "a.txt")
+		p := &md.Pin{ID: id, OwnerID: "alice", CreationTime: time.Now().Add(-2 * time.Hour), GoodFor: time.Hour,
+			Attachments: map[string]string{"a.txt": ref}}
+		if err := ps.Register(ctx, p); err != nil {
+			t.Fatal(err)
+		}
+		if err := fs.Save(ctx, ref, ioutil.NopCloser(strings.NewReader(attachment))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return New(ps, fs, webhook.NewNotifier(ps)), ps
+}
+
+// claimedByOther reports whether junk pin can be claimed by a deleter replica other than d, after which it is
+// released right away
+func claimedByOther(t *testing.T, ps st.PinStore, pinID string) bool {
+	ok, err := ps.Claim(context.Background(), pinID, "other", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		ps.Release(context.Background(), pinID, "other")
+	}
+	return ok
+}
+
+func TestSweepBlocksOnFullQueue(t *testing.T) {
+	d, _ := newTestDeleter(t, st.NewMemoryFileStore(), "p0", "p1", "p2")
+	queue := make(chan *job, 1)
+	done := make(chan *pe.PinErr)
+	go func() {
+		done <- d.sweep(context.Background(), queue, 0)
+	}()
+	// the sweep queues the last junk pin once two of them are taken off the queue
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-done:
+			t.Fatalf("expected sweep blocked with %d junk pins unqueued, got it done with %v", 2-i, err)
+		case <-time.After(50 * time.Millisecond):
+		}
+		if len(queue) != 1 {
+			t.Fatalf("expected queue full, got %d queued", len(queue))
+		}
+		jb := <-queue
+		jb.sweep.wg.Done()
+	}
+	if err := <-done; err != nil {
+		t.Errorf("expected sweep done once all junk pins queued, got %v", err)
+	}
+	if len(queue) != 1 {
+		t.Errorf("expected the last junk pin queued, got %d queued", len(queue))
+	}
+}
+
+func TestSweepReleasesJunkPinsUponCancel(t *testing.T) {
+	d, ps := newTestDeleter(t, st.NewMemoryFileStore(), "p0", "p1", "p2")
+	ctx, cancel := context.WithCancel(context.Background())
+	queue := make(chan *job, 1)
+	done := make(chan *pe.PinErr)
+	go func() {
+		done <- d.sweep(ctx, queue, 0)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	jb := <-queue
+	// junk pins not queued are released, whereas the queued one is held till a worker gets to it
+	for _, id := range []string{"p0", "p1", "p2"} {
+		if expected := id != jb.jk.PinID; claimedByOther(t, ps, id) != expected {
+			t.Errorf("expected junk pin %s claimable by others: %t", id, expected)
+		}
+	}
+	// workers abandon queued junk pins upon shutdown, releasing them as well
+	d.work(ctx, jb)
+	if !claimedByOther(t, ps, jb.jk.PinID) {
+		t.Errorf("expected abandoned junk pin %s claimable by others", jb.jk.PinID)
+	}
+	if n, _ := ps.JunkCount(context.Background()); n != 3 {
+		t.Errorf("expected no junk pin deleted, got %d left", n)
+	}
+}
+
+// failingFileStore fails deleting any file
+type failingFileStore struct {
+	st.FileStore
+}
+
+func (fs *failingFileStore) Delete(ctx context.Context, ref string) *pe.PinErr {
+	return pe.ErrServiceFailure("error deleting file")
+}
+
+func TestFailuresQuarantineJunkPin(t *testing.T) {
+	ctx := context.Background()
+	d, ps := newTestDeleter(t, &failingFileStore{st.NewMemoryFileStore()}, "p")
+	d.Once, d.maxAttempts, d.retryBackoff = true, 2, time.Millisecond
+	if err := d.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if qs, _ := ps.Quarantined(ctx); len(qs) != 0 || atomic.LoadInt64(&d.Rep.Failed) != 1 {
+		t.Fatalf("expected junk pin retried after its first failure, got %d failures, %d quarantined",
+			d.Rep.Failed, len(qs))
+	}
+	// the retry is due once backoff elapses
+	time.Sleep(10 * time.Millisecond)
+	if err := d.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	qs, err := ps.Quarantined(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(qs) != 1 || qs[0].PinID != "p" || qs[0].Attempts != 2 || atomic.LoadInt64(&d.Rep.Quarantined) != 1 {
+		t.Errorf("expected junk pin quarantined after 2 attempts, got %+v", qs)
+	}
+	if n, _ := ps.JunkCount(ctx); n != 0 {
+		t.Errorf("expected quarantined junk pin left alone by sweeps, got %d junk pins", n)
+	}
+}
+
+func TestRunOnce(t *testing.T) {
+	ctx := context.Background()
+	fs := st.NewMemoryFileStore()
+	d, ps := newTestDeleter(t, fs, "p0", "p1", "p2")
+	d.Once, d.Measure = true, true
+	// dry run lists junk pins without touching them
+	var out bytes.Buffer
+	if err := d.DryRun(ctx, &out); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(out.String(), "\n"); n != 3 {
+		t.Errorf("expected 3 junk pins listed in dry run, got %d: %s", n, out.String())
+	}
+	if n, _ := ps.JunkCount(ctx); n != 3 {
+		t.Fatalf("expected junk pins left by dry run, got %d", n)
+	}
+	d.Rep = NewReport(false)
+	// a one-shot run returns once its deletions complete
+	if err := d.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := ps.JunkCount(ctx); n != 0 {
+		t.Errorf("expected junk pins deleted, got %d left", n)
+	}
+	files := 0
+	fs.Walk(ctx, func(pinID, ref string, modTime time.Time) error {
+		files++
+		return nil
+	})
+	if files != 0 {
+		t.Errorf("expected attachments deleted, got %d left", files)
+	}
+	rep := d.Rep
+	if rep.Junk != 3 || rep.Deleted != 3 || rep.Files != 3 || rep.Bytes != int64(3*len(attachment)) {
+		t.Errorf("expected report of 3 deleted junk pins with their attachments, got %+v", rep)
+	}
+}
+
+// chanWatcher streams junk pins sent to its channel
+type chanWatcher chan *md.Junk
+
+func (w chanWatcher) Watch(ctx context.Context) (<-chan *md.Junk, *pe.PinErr) {
+	return w, nil
+}
+
+func TestRunDisposesOfJunkPinsFromEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	d, ps := newTestDeleter(t, st.NewMemoryFileStore(), "p")
+	// sweeps never happen in the test
+	w := make(chanWatcher)
+	d.JW, d.sweepFreq = w, time.Hour
+	done := make(chan *pe.PinErr)
+	go func() {
+		done <- d.Run(ctx)
+	}()
+	jks, err := ps.Junk(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w <- jks[0]
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(10 * time.Millisecond) {
+		if n, _ := ps.JunkCount(ctx); n == 0 {
+			break
+		}
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := ps.JunkCount(ctx); n != 0 || atomic.LoadInt64(&d.Rep.Deleted) != 1 {
+		t.Errorf("expected junk pin reported by event deleted, got %d left", n)
+	}
+}
@@ -0,0 +1,118 @@
+package deleter
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/viper"
+	"wuyrush.io/pin/common/logging"
+	cst "wuyrush.io/pin/constants"
+	pe "wuyrush.io/pin/errors"
+	md "wuyrush.io/pin/models"
+)
+
+// Report summarizes a deleter run, e.g. a one-shot run from cron. Counters are updated atomically
+type Report struct {
+	Junk        int64     `json:"junk"`        // junk pins claimed, or loaded in dry run
+	Deleted     int64     `json:"deleted"`     // junk pins deleted
+	Failed      int64     `json:"failed"`      // failed attempts to delete junk pins
+	Quarantined int64     `json:"quarantined"` // junk pins quarantined after repeated failures
+	Files       int64     `json:"files"`       // attachments deleted, or to delete in dry run
+	Bytes       int64     `json:"bytes"`       // size of attachments deleted, or to delete in dry run
+	DryRun      bool      `json:"dryRun"`
+	Start       time.Time `json:"start"`
+	Duration    string    `json:"duration"`
+}
+
+func NewReport(dryRun bool) *Report {
+	return &Report{DryRun: dryRun, Start: time.Now().UTC()}
+}
+
+// Write writes a snapshot of rep to out in JSON
+func (rep *Report) Write(out io.Writer) error {
+	snap := Report{
+		Junk:        atomic.LoadInt64(&rep.Junk),
+		Deleted:     atomic.LoadInt64(&rep.Deleted),
+		Failed:      atomic.LoadInt64(&rep.Failed),
+		Quarantined: atomic.LoadInt64(&rep.Quarantined),
+		Files:       atomic.LoadInt64(&rep.Files),
+		Bytes:       atomic.LoadInt64(&rep.Bytes),
+		DryRun:      rep.DryRun,
+		Start:       rep.Start,
+		Duration:    time.Since(rep.Start).String(),
+	}
+	return json.NewEncoder(out).Encode(snap)
+}
+
+// junkEntry lists a junk pin in dry run
+type junkEntry struct {
+	PinID    string      `json:"pinId"`
+	OwnerID  string      `json:"ownerId,omitempty"`
+	Expiry   time.Time   `json:"expiry"`
+	Attempts int         `json:"attempts"`
+	Files    []fileEntry `json:"files"`
+}
+
+type fileEntry struct {
+	Ref     string `json:"ref"`
+	Size    int64  `json:"size"`
+	Missing bool   `json:"missing,omitempty"` // the file had gone already
+}
+
+// DryRun lists junk pins a sweep would load, along with their attachments, to out in JSON lines without
+// deleting or claiming anything
+func (d *Deleter) DryRun(ctx context.Context, out io.Writer) *pe.PinErr {
+	clog := logging.WithFuncName().WithContext(ctx)
+	jks, err := d.PS.Junk(ctx, viper.GetInt(cst.EnvDeleterMaxSweepLoad))
+	if err != nil {
+		clog.WithError(err).Error("error loading junk pins from PinStore")
+		return err
+	}
+	enc := json.NewEncoder(out)
+	for _, jk := range jks {
+		e, err := d.entry(ctx, jk)
+		if err != nil {
+			return err
+		}
+		if err := enc.Encode(e); err != nil {
+			return pe.ErrServiceFailure("error writing junk pin").WithCause(err)
+		}
+		d.Rep.Junk++
+		d.Rep.Files += int64(len(e.Files))
+		for _, f := range e.Files {
+			d.Rep.Bytes += f.Size
+		}
+	}
+	return nil
+}
+
+// entry lists junk pin jk along with sizes of its attachments
+func (d *Deleter) entry(ctx context.Context, jk *md.Junk) (*junkEntry, *pe.PinErr) {
+	e := &junkEntry{PinID: jk.PinID, OwnerID: jk.OwnerID, Expiry: jk.Expiry.UTC(), Attempts: jk.Attempts,
+		Files: make([]fileEntry, 0, len(jk.FileRefs))}
+	for _, ref := range jk.FileRefs {
+		size, err := d.FS.Size(ctx, ref)
+		if err != nil && err.Code != pe.ErrCodeNotFound {
+			logging.WithFuncName().WithContext(ctx).WithError(err).WithField("ref", ref).
+				Error("error getting pin attachment size with FileStore")
+			return nil, err
+		}
+		e.Files = append(e.Files, fileEntry{Ref: ref, Size: size, Missing: err != nil})
+	}
+	return e, nil
+}
+
+// size returns total size of attachments of junk pin jk in best-effort manner; attachments whose size is
+// unknown count as empty
+func (d *Deleter) size(ctx context.Context, jk *md.Junk) int64 {
+	var total int64
+	for _, ref := range jk.FileRefs {
+		if n, err := d.FS.Size(ctx, ref); err == nil {
+			total += n
+		}
+	}
+	return total
+}
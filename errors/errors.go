@@ -13,6 +13,7 @@ const (
 	ErrCodeNotFound          ErrCode = "NotFound"
 	ErrCodeServiceFailure    ErrCode = "ServiceFailure"
 	ErrCodeAPIBadRequest     ErrCode = "BadRequest"
+	ErrCodeConflict          ErrCode = "Conflict"
 	ErrCodeDependencyFailure ErrCode = "DepedencyFailure"
 )
 
@@ -76,6 +77,13 @@ func ErrBadInput(m string) *PinErr {
 	}
 }
 
+func ErrConflict(m string) *PinErr {
+	return &PinErr{
+		Code: ErrCodeConflict,
+		msg:  m,
+	}
+}
+
 func ErrNotImplemented() *PinErr {
 	return &PinErr{
 		Code: ErrCodeNotImplemented,
@@ -90,6 +98,8 @@ func (e *PinErr) StatusCode() int {
 		return http.StatusNotFound
 	case ErrCodeAPIBadRequest:
 		return http.StatusBadRequest
+	case ErrCodeConflict:
+		return http.StatusConflict
 	default:
 		return http.StatusInternalServerError
 	}
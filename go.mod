@@ -5,11 +5,17 @@ go 1.13
 require (
 	github.com/bluele/gcache v0.0.0-20190518031135-bc40bd653833
 	github.com/go-redis/redis v6.15.6+incompatible
+	github.com/go-sql-driver/mysql v1.6.0
 	github.com/gorilla/sessions v1.2.0
 	github.com/julienschmidt/httprouter v1.2.0
+	github.com/lib/pq v1.10.9
+	github.com/mattn/go-sqlite3 v1.14.5
 	github.com/onsi/ginkgo v1.11.0 // indirect
 	github.com/onsi/gomega v1.8.1 // indirect
+	github.com/prometheus/client_golang v1.5.1
 	github.com/segmentio/ksuid v1.0.2
 	github.com/sirupsen/logrus v1.4.2
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
 	github.com/spf13/viper v1.6.2
+	go.etcd.io/bbolt v1.3.5
 )
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"fmt"
 	"time"
 )
 
@@ -9,7 +10,8 @@ import (
 */
 
 type User struct {
-	ID string
+	ID    string
+	Email string
 }
 
 func (u *User) Anonymous() bool {
@@ -28,6 +30,32 @@ var AccessModeVals = map[AccessMode]struct{}{
 	AccessModePrivate: {},
 }
 
+func (m AccessMode) String() string {
+	switch m {
+	case AccessModePublic:
+		return "public"
+	case AccessModePrivate:
+		return "private"
+	default:
+		return fmt.Sprintf("AccessMode(%d)", int(m))
+	}
+}
+
+// ViewNotice denotes when to notify pin owner about views of the pin
+type ViewNotice int
+
+const (
+	ViewNoticeNone ViewNotice = iota
+	ViewNoticeFirst
+	ViewNoticeEvery
+)
+
+var ViewNoticeVals = map[ViewNotice]struct{}{
+	ViewNoticeNone:  {},
+	ViewNoticeFirst: {},
+	ViewNoticeEvery: {},
+}
+
 type Pin struct {
 	ID           string
 	OwnerID      string
@@ -38,11 +66,18 @@ type Pin struct {
 	ViewCount    uint64
 	Title        string
 	Note         string
+	NotifyOnView ViewNotice
+	NotifyAddr   string // email address to send view notices to
 	// Attachments stores mappings between attachment's url-encoded filename and
 	// its reference in file storage layer
 	Attachments map[string]string
 }
 
+// OwnedBy checks if the pin belongs to the given user. Pins created in anonymous mode belong to nobody
+func (p *Pin) OwnedBy(u *User) bool {
+	return !u.Anonymous() && p.OwnerID != "" && p.OwnerID == u.ID
+}
+
 func (p *Pin) VisibleTo(u *User) bool {
 	// TODO: implement
 	return false
@@ -53,7 +88,12 @@ func (p *Pin) VisibleTo(u *User) bool {
 // 2. The pin info has ReadAndBurn marked as true and ViewCount >= 1
 // The application shall remove all expired pin info from cache to prevent any further access.
 func (p *Pin) Expired() bool {
-	return time.Now().After(p.CreationTime.Add(p.GoodFor)) || (p.ReadAndBurn && p.ViewCount >= 1)
+	return time.Now().After(p.CreationTime.Add(p.GoodFor)) || p.Burnt()
+}
+
+// Burnt tells whether the pin is read-and-burn and had been viewed
+func (p *Pin) Burnt() bool {
+	return p.ReadAndBurn && p.ViewCount >= 1
 }
 
 // pinView vends necessary pin data for rendering web pages
@@ -61,12 +101,80 @@ type PinView struct {
 	Pin
 	Expiry        time.Time
 	Err           string
+	CSRFToken     string
+	CSPNonce      string // nonce of inline scripts
+	Owned         bool   // whether the pin belongs to the user viewing it
 	URL           string
+	QRCodeURL     string
 	FilenameToURL map[string]string
+	// proof-of-work challenge to solve before creating pin, if any
+	PoWChallenge  string
+	PoWDifficulty int
 }
 
 // Junk represents necessary pin data for deletion purpose
 type Junk struct {
-	PinID    string   // pin ID
-	FileRefs []string // references of pin's attachments on storage layer
+	PinID    string    // pin ID
+	OwnerID  string    // ID of pin owner; empty if pin was created in anonymous mode
+	FileRefs []string  // references of pin's attachments on storage layer
+	Expiry   time.Time // when the pin expired or got burnt
+	Attempts int       // number of failed attempts to delete the pin so far
+}
+
+// JunkFailure records failed attempts to delete a junk pin
+type JunkFailure struct {
+	PinID       string    `json:"pinId"`
+	Attempts    int       `json:"attempts"`
+	LastErr     string    `json:"lastErr"`
+	LastAttempt time.Time `json:"lastAttempt"`
+	Expiry      time.Time `json:"expiry"` // when the pin expired or got burnt
+}
+
+// access kinds
+const (
+	AccessKindView     = "view"
+	AccessKindDownload = "download"
+)
+
+// Access records an access to pin or its attachment
+type Access struct {
+	Time      time.Time `json:"time"`
+	Kind      string    `json:"kind"`
+	Filename  string    `json:"filename,omitempty"` // name of the downloaded attachment, if any
+	IPHash    string    `json:"ipHash"`
+	UserAgent string    `json:"userAgent"`
+	UserID    string    `json:"userId,omitempty"` // ID of the logged in user, if any
+}
+
+// Webhook is an endpoint registered by user to receive callbacks about lifecycle events of pins they own
+type Webhook struct {
+	ID           string    `json:"id"`
+	OwnerID      string    `json:"ownerId"`
+	URL          string    `json:"url"`
+	Secret       string    `json:"secret,omitempty"` // key to sign callback payloads with HMAC-SHA256
+	Events       []string  `json:"events"`           // types of events to receive
+	CreationTime time.Time `json:"creationTime"`
+}
+
+// Subscribed checks if the webhook receives events of the given type
+func (h *Webhook) Subscribed(event string) bool {
+	for _, e := range h.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Delivery records the outcome of delivering an event to a webhook
+type Delivery struct {
+	ID         string    `json:"id"`
+	HookID     string    `json:"hookId"`
+	Event      string    `json:"event"`
+	PinID      string    `json:"pinId"`
+	Time       time.Time `json:"time"`
+	Attempts   int       `json:"attempts"`
+	StatusCode int       `json:"statusCode,omitempty"` // status code of the last attempt, if any
+	Err        string    `json:"error,omitempty"`      // error of the last attempt, if any
+	Succeeded  bool      `json:"succeeded"`
 }
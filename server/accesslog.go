@@ -0,0 +1,111 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/spf13/viper"
+	"wuyrush.io/pin/common/logging"
+	"wuyrush.io/pin/common/pinid"
+	cst "wuyrush.io/pin/constants"
+	pe "wuyrush.io/pin/errors"
+	md "wuyrush.io/pin/models"
+)
+
+// logAccess records an access to pin p in its access log. Failing to do so doesn't fail the access
+func (s *pinServer) logAccess(r *http.Request, p *md.Pin, kind, filename string) {
+	a := &md.Access{
+		Time:      time.Now().UTC(),
+		Kind:      kind,
+		Filename:  filename,
+		IPHash:    hashIP(r),
+		UserAgent: r.UserAgent(),
+	}
+	if u := s.currentUser(r); !u.Anonymous() {
+		a.UserID = u.ID
+	}
+	if err := s.AL.LogAccess(r.Context(), p.ID, a, p.CreationTime.Add(p.GoodFor)); err != nil {
+		logging.WithFuncName().WithContext(r.Context()).WithError(err).WithField("pinID", p.ID).Error("error logging pin access")
+	}
+}
+
+// hashIP returns the keyed hash of requester's IP address so that owners can tell accesses from the same
+// address apart without learning the address itself
+func hashIP(r *http.Request) string {
+	mac := hmac.New(sha256.New, []byte(viper.GetString(cst.EnvAccessLogSalt)))
+	mac.Write([]byte(clientAddr(r)))
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// HandleTaskGetPinAccessLog renders access log of a pin to its owner
+func (s *pinServer) HandleTaskGetPinAccessLog() httprouter.Handle {
+	clog := logging.WithFuncName()
+	tmplPath := "templates/access_log.html"
+	tmpl, err := template.ParseFiles(tmplPath)
+	if err != nil {
+		clog.WithError(err).WithField("templatePath", tmplPath).Fatal("html template not loaded")
+	}
+	type View struct {
+		Err    string
+		PinID  string
+		Title  string
+		Access []*md.Access
+	}
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		clog := clog.WithContext(r.Context())
+		pinID := ps.ByName("id")
+		plog := clog.WithField("pinID", pinID)
+		p, as, err := s.ownedAccessLog(r, pinID)
+		if err != nil {
+			plog.WithError(err).Error("error getting pin access log")
+			w.WriteHeader(err.StatusCode())
+			execTemplateLog(tmpl, w, View{Err: err.Error(), PinID: pinID}, plog.WithField("templatePath", tmplPath))
+			return
+		}
+		execTemplateLog(tmpl, w, View{PinID: p.ID, Title: p.Title, Access: as},
+			plog.WithField("templatePath", tmplPath))
+	}
+}
+
+// HandleAPIGetPinAccessLog returns access log of a pin to its owner in JSON
+func (s *pinServer) HandleAPIGetPinAccessLog() httprouter.Handle {
+	clog := logging.WithFuncName()
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		clog := clog.WithContext(r.Context())
+		pinID := ps.ByName("id")
+		plog := clog.WithField("pinID", pinID)
+		_, as, err := s.ownedAccessLog(r, pinID)
+		if err != nil {
+			plog.WithError(err).Error("error getting pin access log")
+			http.Error(w, err.Error(), err.StatusCode())
+			return
+		}
+		writeJSON(w, http.StatusOK, as, plog)
+	}
+}
+
+// ownedAccessLog returns the pin along with its access log if the requester owns the pin. Existence of the pin is
+// hidden from non-owners
+func (s *pinServer) ownedAccessLog(r *http.Request, pinID string) (*md.Pin, []*md.Access, *pe.PinErr) {
+	if !pinid.Valid(pinID) {
+		return nil, nil, pe.ErrNotFound(errMsgPinNotFound)
+	}
+	p, err := s.PS.Get(r.Context(), pinID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !p.OwnedBy(s.currentUser(r)) {
+		logging.WithFuncName().WithContext(r.Context()).WithField("pinID", pinID).Warn("non-owner attempted to get pin access log")
+		return nil, nil, pe.ErrNotFound(errMsgPinNotFound)
+	}
+	as, err := s.AL.AccessLog(r.Context(), pinID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return p, as, nil
+}
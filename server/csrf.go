@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+
+	"github.com/spf13/viper"
+	"wuyrush.io/pin/common/logging"
+	cst "wuyrush.io/pin/constants"
+)
+
+const (
+	// session value key of the CSRF token
+	sessKeyCSRFToken = "csrfToken"
+	// name of the form field and header carrying CSRF token
+	csrfFormField = "csrf-token"
+	csrfHeader    = "X-CSRF-Token"
+	csrfTokenSize = 32
+)
+
+type ctxKey int
+
+const (
+	ctxKeyCSRFToken ctxKey = iota
+	ctxKeyCSPNonce
+	ctxKeyUser
+)
+
+// HandleCSRF is a middleware against cross-site request forgery. It keeps a token per session and exposes it to
+// handlers via csrfToken(), so that they can embed the token into forms. State-changing requests must come from
+// the same origin and carry the token in either form field or header. Requests authenticated by API token are
+// exempted since they carry no ambient credentials: browsers never attach Authorization headers on their own, and
+// such requests are never resolved to the user of the session
+func (s *pinServer) HandleCSRF(h http.Handler) http.Handler {
+	clog := logging.WithFuncName()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clog := clog.WithContext(r.Context())
+		if bearerToken(r) != "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		// gorilla returns a new session along with the error if the existing one cannot be decoded
+		sess, err := s.SS.Get(r, sessName)
+		if err != nil {
+			clog.WithError(err).Debug("error loading session. Starting a new one")
+		}
+		token, _ := sess.Values[sessKeyCSRFToken].(string)
+		if token == "" {
+			b := make([]byte, csrfTokenSize)
+			if _, err := rand.Read(b); err != nil {
+				clog.WithError(err).Error("error generating CSRF token")
+				http.Error(w, "error generating CSRF token", http.StatusInternalServerError)
+				return
+			}
+			token = hex.EncodeToString(b)
+			sess.Values[sessKeyCSRFToken] = token
+			if err := sess.Save(r, w); err != nil {
+				clog.WithError(err).Error("error saving session")
+				http.Error(w, "error saving session", http.StatusInternalServerError)
+				return
+			}
+		}
+		if stateChanging(r.Method) {
+			if !sameOrigin(r) {
+				clog.WithField("origin", r.Header.Get("Origin")).Warn("rejected cross-origin request")
+				http.Error(w, "cross-origin request rejected", http.StatusForbidden)
+				return
+			}
+			got := r.Header.Get(csrfHeader)
+			if got == "" {
+				if code, msg, err := parseForm(w, r); err != nil {
+					clog.WithError(err).Error(msg)
+					http.Error(w, msg, code)
+					return
+				}
+				defer removeMultipartForm(r)
+				got = r.PostFormValue(csrfFormField)
+			}
+			if !hmac.Equal([]byte(got), []byte(token)) {
+				clog.Warn("rejected request with missing or invalid CSRF token")
+				http.Error(w, "invalid CSRF token. Please reload the page and retry", http.StatusForbidden)
+				return
+			}
+		}
+		r = r.WithContext(context.WithValue(r.Context(), ctxKeyCSRFToken, token))
+		// handlers parse forms on the request handed to them, if not parsed here already
+		defer removeMultipartForm(r)
+		h.ServeHTTP(w, r)
+	})
+}
+
+// csrfToken returns the CSRF token of the session of request r
+func csrfToken(r *http.Request) string {
+	token, _ := r.Context().Value(ctxKeyCSRFToken).(string)
+	return token
+}
+
+func stateChanging(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return false
+	default:
+		return true
+	}
+}
+
+// sameOrigin reports whether request r originates from the service itself, judging by its Origin header or
+// Referer header otherwise. Requests carrying neither are let through and left to token validation
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		origin = r.Referer()
+	}
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	host := r.Host
+	if base := viper.GetString(cst.EnvAppBaseURL); base != "" {
+		if bu, err := url.Parse(base); err == nil {
+			host = bu.Host
+		}
+	}
+	return u.Host == host
+}
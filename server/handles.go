@@ -2,28 +2,36 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"encoding/json"
 	"fmt"
 	"html/template"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/julienschmidt/httprouter"
-	"github.com/segmentio/ksuid"
 	"github.com/sirupsen/logrus"
+	"github.com/skip2/go-qrcode"
 	"github.com/spf13/viper"
 	"wuyrush.io/pin/common/logging"
+	"wuyrush.io/pin/common/metrics"
+	"wuyrush.io/pin/common/pinid"
 	cst "wuyrush.io/pin/constants"
 	pe "wuyrush.io/pin/errors"
 	md "wuyrush.io/pin/models"
+	"wuyrush.io/pin/webhook"
 )
 
 const (
 	goodForMin        = time.Second * 30
 	goodForMax        = time.Hour * 24
 	errMsgPinNotFound = "pin not found"
+	qrCodeSizePx      = 256
 )
 
 func (s *pinServer) HandleTaskGetCreatePinPage() httprouter.Handle {
@@ -35,7 +43,8 @@ func (s *pinServer) HandleTaskGetCreatePinPage() httprouter.Handle {
 		clog.WithError(err).WithField("templatePath", tmplPath).Fatal("html template not loaded")
 	}
 	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-		if err := tmpl.Execute(w, nil); err != nil {
+		clog := clog.WithContext(r.Context())
+		if err := tmpl.Execute(w, s.createPinView(r, nil, "")); err != nil {
 			clog.WithError(err).WithField("templatePath", tmplPath).Error("error executing html template")
 		}
 	}
@@ -51,7 +60,6 @@ func (s *pinServer) HandleTaskCreatePin() httprouter.Handle {
 	clog := logging.WithFuncName().WithField("httpMethod", http.MethodPost)
 	tmplPathCreatePin := "templates/create_pin.html"
 	tmplPathGetPin := "templates/get_pin.html"
-	maxReqBodySize := viper.GetInt64(cst.EnvReqBodySizeMaxByte)
 	// fail early if err since this is critical path
 	tmplCreatePin, err := template.ParseFiles(tmplPathCreatePin)
 	if err != nil {
@@ -62,76 +70,56 @@ func (s *pinServer) HandleTaskCreatePin() httprouter.Handle {
 		clog.WithError(err).WithField("templatePath", tmplPathGetPin).Fatal("html template not loaded")
 	}
 	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		clog := clog.WithContext(r.Context())
 		// limit request size and parse request form
-		r.Body = http.MaxBytesReader(w, r.Body, maxReqBodySize)
-		if err := r.ParseMultipartForm(128); err != nil {
-			code, msg := http.StatusBadRequest, "error parsing form"
-			if strings.Index(err.Error(), "http: request body too large") >= 0 {
-				msg = fmt.Sprintf("request oversized. Request size must be under %f mebibyte",
-					float64(maxReqBodySize)/(1024.*1024.))
-				code = http.StatusRequestEntityTooLarge
-			}
+		if code, msg, err := parseForm(w, r); err != nil {
 			clog.WithError(err).Error(msg)
 			http.Error(w, msg, code)
 			return
 		}
+		// 0. bot defence for anonymous requester
+		if err := s.verifyPoW(r); err != nil {
+			clog.WithError(err).Warn("proof-of-work verification failed")
+			w.WriteHeader(err.StatusCode())
+			execTemplateLog(tmplCreatePin, w, s.createPinView(r, nil, err.Error()),
+				clog.WithField("templatePath", tmplPathCreatePin))
+			return
+		}
 		// 1. assemble and validate pin data
 		p, err := s.buildPin(r)
 		if err != nil {
 			clog.WithError(err).Error("error building pin from input data")
 			w.WriteHeader(err.StatusCode())
-			execTemplateLog(tmplCreatePin, w, md.PinView{Pin: *p, Err: err.Error()},
+			execTemplateLog(tmplCreatePin, w, s.createPinView(r, p, err.Error()),
 				clog.WithField("templatePath", tmplPathCreatePin))
 			return
 		}
-		plog := clog.WithField("pinID", p.ID)
 		p.CreationTime = time.Now()
 		pinExpiry := p.CreationTime.Add(p.GoodFor)
 		// register pin
-		if err := s.PS.Register(p); err != nil {
-			plog.WithError(err).Error("error registering pin data")
-			w.WriteHeader(err.StatusCode())
-			execTemplateLog(tmplCreatePin, w, md.PinView{Pin: *p, Err: err.Error()},
-				plog.WithField("templatePath", tmplPathCreatePin))
-			return
+		scheme := pinid.SchemeKsuid
+		if r.FormValue("readable-id") == "true" {
+			scheme = pinid.SchemeWords
 		}
-		// save pin metadata
-		if err := s.PS.Save(p); err != nil {
-			plog.WithError(err).Error("error saving pin metadata")
+		if err := s.createPin(r.Context(), p, scheme, r.MultipartForm.File["attachments"]); err != nil {
+			clog.WithError(err).Error("error creating pin")
 			w.WriteHeader(err.StatusCode())
-			execTemplateLog(tmplCreatePin, w, md.PinView{Pin: *p, Err: err.Error()},
-				plog.WithField("templatePath", tmplPathCreatePin))
+			execTemplateLog(tmplCreatePin, w, s.createPinView(r, p, err.Error()),
+				clog.WithField("templatePath", tmplPathCreatePin))
 			return
 		}
-		// save pin attachment data
+		plog := clog.WithField("pinID", p.ID)
 		for _, fh := range r.MultipartForm.File["attachments"] {
-			flog := plog.WithField("filename", fh.Filename)
-			ref := p.Attachments[fh.Filename]
-			f, err := fh.Open()
-			if err != nil {
-				flog.WithError(err).WithField("filename", fh.Filename).Error("error opening pin attachment")
-				w.WriteHeader(http.StatusInternalServerError)
-				execTemplateLog(tmplCreatePin, w, md.PinView{
-					Pin: *p,
-					Err: fmt.Sprintf("error opening attachment %s: %s", fh.Filename, err),
-				}, flog.WithField("templatePath", tmplPathCreatePin))
-				return
-			}
-			defer f.Close()
-			if err := s.FS.Save(ref, f); err != nil {
-				flog.WithError(err).WithField("filename", fh.Filename).Error("error saving pin attachment")
-				w.WriteHeader(err.StatusCode())
-				execTemplateLog(tmplCreatePin, w, md.PinView{
-					Pin: *p,
-					Err: fmt.Sprintf("error saving attachment %s: %s", fh.Filename, err),
-				}, flog.WithField("templatePath", tmplPathCreatePin))
-				return
-			}
+			metrics.AttachmentBytes.Add(float64(fh.Size))
 		}
+		metrics.PinsCreated.WithLabelValues(p.Mode.String()).Inc()
+		s.NT.Notify(r.Context(), p.OwnerID, webhook.EventPinCreated, p.ID)
 		// rendered the saved pin info page so that customer can double check if the info is expected
 		pv := md.PinView{
 			Pin:           *p,
-			URL:           fmt.Sprintf("/pin/%s", p.ID), // TODO: compute the full url
+			CSRFToken:     csrfToken(r),
+			URL:           absURL(r, fmt.Sprintf("/pin/%s", p.ID)),
+			QRCodeURL:     fmt.Sprintf("/pin/%s/qr.png", p.ID),
 			Expiry:        pinExpiry,
 			FilenameToURL: map[string]string{},
 		}
@@ -142,19 +130,16 @@ func (s *pinServer) HandleTaskCreatePin() httprouter.Handle {
 	}
 }
 
+// buildPin assembles pin from request data. The pin gets its ID and attachment references upon registration
 func (s *pinServer) buildPin(r *http.Request) (*md.Pin, *pe.PinErr) {
-	const respMsgErrPinInfo = "error pinning info"
-	// 3. generate pin id
-	pinKsuid, err := ksuid.NewRandom()
-	if err != nil {
-		logging.WithFuncName().WithError(err).Error("fail to generate pin id")
-		return nil, pe.ErrServiceFailure(respMsgErrPinInfo).WithCause(err)
-	}
 	p := &md.Pin{
-		ID:    pinKsuid.String(),
 		Title: r.FormValue("title"),
 		Note:  r.FormValue("note"),
 	}
+	u := s.currentUser(r)
+	if !u.Anonymous() {
+		p.OwnerID = u.ID
+	}
 	p.Mode = md.AccessModePublic
 	if r.FormValue("private") == "true" {
 		p.Mode = md.AccessModePrivate
@@ -171,14 +156,115 @@ func (s *pinServer) buildPin(r *http.Request) (*md.Pin, *pe.PinErr) {
 		return p, pe.ErrBadInput("good-for period out of range")
 	}
 	p.GoodFor = goodFor
+	if v := r.FormValue("notify-on-view"); v != "" {
+		vn, err := strconv.Atoi(v)
+		if _, ok := md.ViewNoticeVals[md.ViewNotice(vn)]; err != nil || !ok {
+			return p, pe.ErrBadInput("invalid view notice setting")
+		}
+		if md.ViewNotice(vn) != md.ViewNoticeNone {
+			if u.Anonymous() || u.Email == "" {
+				return p, pe.ErrBadInput("view notices are available to registered users only")
+			}
+			p.NotifyOnView, p.NotifyAddr = md.ViewNotice(vn), u.Email
+		}
+	}
 	p.Attachments = map[string]string{}
 	fs := r.MultipartForm.File
 	for _, fh := range fs["attachments"] {
-		p.Attachments[fh.Filename] = s.FS.Ref(p.ID, fh.Filename)
+		p.Attachments[fh.Filename] = ""
 	}
 	return p, nil
 }
 
+// createPin registers p, stores its attachments and saves its metadata last, so that the pin becomes visible
+// only after all its data is in place. Any failure rolls back the partial state via compensating deletes
+func (s *pinServer) createPin(ctx context.Context, p *md.Pin, scheme pinid.Scheme, fhs []*multipart.FileHeader) *pe.PinErr {
+	clog := logging.WithFuncName().WithContext(ctx)
+	if err := s.registerPin(ctx, p, scheme); err != nil {
+		return err
+	}
+	clog = clog.WithField("pinID", p.ID)
+	// refs of attachments which may have been stored, including partially stored ones
+	var refs []string
+	rollback := func() {
+		// pins stay registered if rollback fails halfway, hence get cleaned up by deleter once they expire
+		for _, ref := range refs {
+			if err := s.FS.Delete(ctx, ref); err != nil {
+				clog.WithError(err).WithField("ref", ref).Error("error rolling back pin attachment")
+				return
+			}
+		}
+		if err := s.PS.Delete(ctx, p.ID); err != nil {
+			clog.WithError(err).Error("error rolling back pin metadata")
+			return
+		}
+		if err := s.PS.Deregister(ctx, p.ID); err != nil {
+			clog.WithError(err).Error("error rolling back pin registration")
+			return
+		}
+		clog.Info("rolled back pin creation")
+	}
+	for _, fh := range fhs {
+		ref := p.Attachments[fh.Filename]
+		refs = append(refs, ref)
+		if err := s.saveAttachment(ctx, ref, fh); err != nil {
+			clog.WithError(err).WithField("filename", fh.Filename).Error("error saving pin attachment")
+			rollback()
+			return err
+		}
+	}
+	if err := s.PS.Save(ctx, p); err != nil {
+		clog.WithError(err).Error("error saving pin metadata")
+		rollback()
+		return err
+	}
+	return nil
+}
+
+// saveAttachment stores the attachment of file header fh with FileStore under ref
+func (s *pinServer) saveAttachment(ctx context.Context, ref string, fh *multipart.FileHeader) *pe.PinErr {
+	f, err := fh.Open()
+	if err != nil {
+		return pe.ErrServiceFailure(fmt.Sprintf("error opening attachment %s: %s", fh.Filename, err)).WithCause(err)
+	}
+	defer f.Close()
+	if err := s.FS.Save(ctx, ref, f); err != nil {
+		msg := fmt.Sprintf("error saving attachment %s: %s", fh.Filename, err)
+		if err.Code == pe.ErrCodeAPIBadRequest {
+			return pe.ErrBadInput(msg).WithCause(err)
+		}
+		return pe.ErrServiceFailure(msg).WithCause(err)
+	}
+	return nil
+}
+
+// registerPin assigns p an ID of the given scheme and registers p with PinStore. It retries with fresh IDs in
+// case of ID collision, which is likely only for word-based IDs
+func (s *pinServer) registerPin(ctx context.Context, p *md.Pin, scheme pinid.Scheme) *pe.PinErr {
+	const (
+		respMsgErrPinInfo = "error pinning info"
+		maxAttempts       = 3
+	)
+	clog := logging.WithFuncName().WithContext(ctx)
+	for i := 0; i < maxAttempts; i++ {
+		id, err := pinid.New(scheme, viper.GetInt(cst.EnvPinIDWordCount))
+		if err != nil {
+			clog.WithError(err).Error("fail to generate pin id")
+			return pe.ErrServiceFailure(respMsgErrPinInfo).WithCause(err)
+		}
+		p.ID = id
+		for fn := range p.Attachments {
+			p.Attachments[fn] = s.FS.Ref(p.ID, fn)
+		}
+		perr := s.PS.Register(ctx, p)
+		if perr == nil || perr.Code != pe.ErrCodeConflict {
+			return perr
+		}
+		clog.WithField("pinID", p.ID).Warn("pin id taken. Retrying with a new one")
+	}
+	return pe.ErrServiceFailure(respMsgErrPinInfo).WithCause(fmt.Errorf("pin id collided %d times", maxAttempts))
+}
+
 func (s *pinServer) HandleTaskGetPin() httprouter.Handle {
 	clog := logging.WithFuncName()
 	tmplPath := "templates/get_pin.html"
@@ -187,26 +273,36 @@ func (s *pinServer) HandleTaskGetPin() httprouter.Handle {
 		clog.WithError(err).WithField("templatePath", tmplPath).Fatal("html template not loaded")
 	}
 	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		clog := clog.WithContext(r.Context())
 		// 0. validate input pin id
 		pinID := ps.ByName("id")
 		plog := clog.WithField("pinID", pinID)
-		if _, err := ksuid.Parse(pinID); err != nil {
-			plog.WithError(err).Error("got invalid pin ID")
+		if !pinid.Valid(pinID) {
+			plog.Error("got invalid pin ID")
 			http.NotFound(w, r)
+			return
 		}
-		// 1. get pin data from pin store
-		p, err := s.PS.Get(pinID)
+		// 1. get pin data from pin store, which also counts the view and burns read-and-burn pin
+		// TODO: access control - check if the pin is accessible to the requester or not before counting the view
+		p, err := s.PS.View(r.Context(), pinID)
 		if err != nil {
 			plog.WithError(err).Error("error getting pin from pinStore")
 			w.WriteHeader(err.StatusCode())
 			execTemplateLog(tmpl, w, md.PinView{Err: err.Error()}, plog.WithField("templatePath", tmplPath))
 			return
 		}
-		// TODO: 2. access control - check if the pin is accessible to the requester or not
-		// TODO: 3. read-and-burn - update view count  <- this should be done by pinStore
-		// 4. assemble response and return
+		s.NT.Notify(r.Context(), p.OwnerID, webhook.EventPinViewed, p.ID)
+		if p.ReadAndBurn {
+			s.NT.Notify(r.Context(), p.OwnerID, webhook.EventPinBurned, p.ID)
+		}
+		s.noticeView(r, p)
+		s.logAccess(r, p, md.AccessKindView, "")
+		// 2. assemble response and return
 		pv := md.PinView{
 			Pin:           *p,
+			CSRFToken:     csrfToken(r),
+			Owned:         p.OwnedBy(s.currentUser(r)),
+			Expiry:        p.CreationTime.Add(p.GoodFor),
 			FilenameToURL: map[string]string{},
 		}
 		for fn := range p.Attachments {
@@ -217,6 +313,48 @@ func (s *pinServer) HandleTaskGetPin() httprouter.Handle {
 	}
 }
 
+// HandleTaskExtendPin handles owner's request to extend the good-for period of a pin. The extended pin must
+// still expire within the hard limit counted from its creation time
+func (s *pinServer) HandleTaskExtendPin() httprouter.Handle {
+	clog := logging.WithFuncName().WithField("httpMethod", http.MethodPost)
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		clog := clog.WithContext(r.Context())
+		pinID := ps.ByName("id")
+		plog := clog.WithField("pinID", pinID)
+		if !pinid.Valid(pinID) {
+			plog.Error("got invalid pin ID")
+			http.Error(w, errMsgPinNotFound, http.StatusNotFound)
+			return
+		}
+		extendBy, err := time.ParseDuration(r.FormValue("extend-by"))
+		if err != nil || extendBy <= 0 {
+			http.Error(w, "error parsing extension period", http.StatusBadRequest)
+			return
+		}
+		p, gerr := s.PS.Get(r.Context(), pinID)
+		if gerr != nil {
+			plog.WithError(gerr).Error("error getting pin from pinStore")
+			http.Error(w, gerr.Error(), gerr.StatusCode())
+			return
+		}
+		// hide existence of the pin from non-owners
+		if !p.OwnedBy(s.currentUser(r)) {
+			plog.Warn("non-owner attempted to extend pin")
+			http.Error(w, errMsgPinNotFound, http.StatusNotFound)
+			return
+		}
+		// the extension adds up to the good-for period as stored, which may have been extended since Get
+		goodFor, perr := s.PS.Extend(r.Context(), p, extendBy, goodForMax)
+		if perr != nil {
+			plog.WithError(perr).Error("error extending pin expiry")
+			http.Error(w, perr.Error(), perr.StatusCode())
+			return
+		}
+		plog.WithField("goodFor", goodFor).Info("pin expiry extended")
+		http.Redirect(w, r, fmt.Sprintf("/pin/%s", p.ID), http.StatusSeeOther)
+	}
+}
+
 // HandleTaskDeletePin handles request to remove a specified pinned information. Note
 func (s *pinServer) HandleTaskDeletePin() httprouter.Handle {
 	// TODO: implement
@@ -228,10 +366,11 @@ func (s *pinServer) HandleTaskDeletePin() httprouter.Handle {
 func (s *pinServer) HandleTaskGetPinAttachment() httprouter.Handle {
 	clog := logging.WithFuncName()
 	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		clog := clog.WithContext(r.Context())
 		pinID, urlencodedFn := ps.ByName("id"), ps.ByName("filename")
-		if _, err := ksuid.Parse(pinID); err != nil {
-			clog.WithError(err).Error("got invalid pin ID")
-			http.Error(w, "pin not found", http.StatusNotFound)
+		if !pinid.Valid(pinID) {
+			clog.WithField("pinID", pinID).Error("got invalid pin ID")
+			http.Error(w, errMsgPinNotFound, http.StatusNotFound)
 			return
 		}
 		filename, err := url.PathUnescape(urlencodedFn)
@@ -240,7 +379,7 @@ func (s *pinServer) HandleTaskGetPinAttachment() httprouter.Handle {
 			return
 		}
 		flog := clog.WithFields(logrus.Fields{"pinID": pinID, "filename": filename})
-		p, gerr := s.PS.Get(pinID)
+		p, gerr := s.PS.Get(r.Context(), pinID)
 		if gerr != nil {
 			flog.WithError(gerr).Error("error getting pin data")
 			http.Error(w, gerr.Error(), gerr.StatusCode())
@@ -253,7 +392,7 @@ func (s *pinServer) HandleTaskGetPinAttachment() httprouter.Handle {
 				http.StatusNotFound)
 			return
 		}
-		rc, gerr := s.FS.Get(ref)
+		rc, gerr := s.FS.Get(r.Context(), ref)
 		if gerr != nil {
 			flog.WithError(gerr).Error("error getting io stream of attachment")
 			http.Error(w, gerr.Error(), gerr.StatusCode())
@@ -264,6 +403,8 @@ func (s *pinServer) HandleTaskGetPinAttachment() httprouter.Handle {
 		// header to force download behavior on browser clients
 		headers := w.Header()
 		headers.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+		headers.Set("Content-Type", "application/octet-stream")
+		headers.Set("Content-Security-Policy", cspAttachment)
 		w.WriteHeader(http.StatusOK)
 		if n, err := rd.WriteTo(w); err != nil {
 			// TODO: discern client errors(client closed connection etc) from server ones
@@ -271,6 +412,43 @@ func (s *pinServer) HandleTaskGetPinAttachment() httprouter.Handle {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 		} else {
 			flog.WithField("bytesWritten", n).Info("attachment sent to requester successfully")
+			s.logAccess(r, p, md.AccessKindDownload, filename)
+		}
+	}
+}
+
+// HandleTaskGetPinQRCode renders the absolute url of a pin as QR code in PNG format. The code is generated
+// in-process so that pin urls never leave the service
+func (s *pinServer) HandleTaskGetPinQRCode() httprouter.Handle {
+	clog := logging.WithFuncName()
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		clog := clog.WithContext(r.Context())
+		pinID := ps.ByName("id")
+		plog := clog.WithField("pinID", pinID)
+		if !pinid.Valid(pinID) {
+			plog.Error("got invalid pin ID")
+			http.Error(w, errMsgPinNotFound, http.StatusNotFound)
+			return
+		}
+		// only vend QR code for pins which are still around
+		if _, err := s.PS.Get(r.Context(), pinID); err != nil {
+			plog.WithError(err).Error("error getting pin from pinStore")
+			http.Error(w, err.Error(), err.StatusCode())
+			return
+		}
+		png, err := qrcode.Encode(absURL(r, fmt.Sprintf("/pin/%s", pinID)), qrcode.Medium, qrCodeSizePx)
+		if err != nil {
+			plog.WithError(err).Error("error encoding pin url as QR code")
+			http.Error(w, "error generating QR code", http.StatusInternalServerError)
+			return
+		}
+		headers := w.Header()
+		headers.Set("Content-Type", "image/png")
+		// the QR code is as sensitive as the pin url itself
+		headers.Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		if _, err := w.Write(png); err != nil {
+			plog.WithError(err).Error("error sending QR code to requester")
 		}
 	}
 }
@@ -297,13 +475,15 @@ func (s *pinServer) HandleTaskRegister() httprouter.Handle {
 		clog.WithError(err).WithField("templatePath", tmplPath).Fatal("html template not loaded")
 	}
 	type View struct {
-		Err   string
-		Email string
+		Err       string
+		Email     string
+		CSRFToken string
 	}
 	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		clog := clog.WithContext(r.Context())
 		switch r.Method {
 		case http.MethodGet:
-			execTemplateLog(tmpl, w, View{}, clog.WithField("templatePath", tmplPath))
+			execTemplateLog(tmpl, w, View{CSRFToken: csrfToken(r)}, clog.WithField("templatePath", tmplPath))
 		case http.MethodPost:
 			http.Error(w, "unsupported http method", http.StatusBadRequest)
 		default:
@@ -349,9 +529,115 @@ func (s *pinServer) HandleAuthZ(h httprouter.Handle) httprouter.Handle {
 	}
 }
 
-// TODO: emit request latency metrics by implementing instrument middlewares
+// HandleUser is a middleware resolving the user issuing the request from API token or session once, so that
+// both middlewares and handlers down the chain get the user from request context via currentUser()
+func (s *pinServer) HandleUser(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), ctxKeyUser, s.resolveUser(r))
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
 
 // -------------- utils --------------
+// currentUser returns the user issuing request r, or nil if the requester is anonymous. The user is taken from
+// request context if resolved by HandleUser, otherwise resolved on the spot
+func (s *pinServer) currentUser(r *http.Request) *md.User {
+	if u, ok := r.Context().Value(ctxKeyUser).(*md.User); ok {
+		return u
+	}
+	return s.resolveUser(r)
+}
+
+// resolveUser returns the user issuing request r, or nil if the requester is anonymous. Requests bearing API
+// token are issued by the token owner, and others by the user logged in the session
+func (s *pinServer) resolveUser(r *http.Request) *md.User {
+	if token := bearerToken(r); token != "" {
+		u, err := s.TS.UserByToken(r.Context(), token)
+		if err != nil {
+			logging.WithFuncName().WithContext(r.Context()).WithError(err).Debug("error looking up API token. Treat requester as anonymous")
+			return nil
+		}
+		return u
+	}
+	sess, err := s.SS.Get(r, sessName)
+	if err != nil {
+		logging.WithFuncName().WithContext(r.Context()).WithError(err).Debug("error loading session. Treat requester as anonymous")
+		return nil
+	}
+	id, ok := sess.Values[sessKeyUserID].(string)
+	if !ok || id == "" {
+		return nil
+	}
+	email, _ := sess.Values[sessKeyEmail].(string)
+	return &md.User{ID: id, Email: email}
+}
+
+// parseForm limits request body size and parses request form of either url or multipart encoding. It is safe to
+// call parseForm multiple times on the same request, so that both middlewares and handlers can access the form.
+// Upon error it returns the status code and message to respond with
+func parseForm(w http.ResponseWriter, r *http.Request) (int, string, error) {
+	maxReqBodySize := viper.GetInt64(cst.EnvReqBodySizeMaxByte)
+	// parsed already
+	if r.PostForm != nil {
+		return 0, "", nil
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxReqBodySize)
+	var err error
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		err = r.ParseMultipartForm(128)
+	} else {
+		err = r.ParseForm()
+	}
+	if err != nil {
+		code, msg := http.StatusBadRequest, "error parsing form"
+		if strings.Index(err.Error(), "http: request body too large") >= 0 {
+			msg = fmt.Sprintf("request oversized. Request size must be under %f mebibyte",
+				float64(maxReqBodySize)/(1024.*1024.))
+			code = http.StatusRequestEntityTooLarge
+		}
+		return code, msg, err
+	}
+	return 0, "", nil
+}
+
+// removeMultipartForm removes temporary files of the multipart form parsed on request r, if any. net/http does
+// so for the request it hands to the outermost handler only, whereas middlewares hand copies down the chain
+func removeMultipartForm(r *http.Request) {
+	if r.MultipartForm != nil {
+		r.MultipartForm.RemoveAll()
+	}
+}
+
+// bearerToken returns the API token carried by request r, if any
+func bearerToken(r *http.Request) string {
+	const prefix = "Bearer "
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, prefix) {
+		return strings.TrimSpace(h[len(prefix):])
+	}
+	return ""
+}
+
+// absURL returns the absolute form of url path p. The base url is taken from configuration if any, otherwise
+// it is derived from the incoming request
+func absURL(r *http.Request, p string) string {
+	if base := viper.GetString(cst.EnvAppBaseURL); base != "" {
+		return strings.TrimSuffix(base, "/") + p
+	}
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, r.Host, p)
+}
+
+func writeJSON(w http.ResponseWriter, code int, data interface{}, log *logrus.Entry) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		log.WithError(err).Error("error writing JSON response")
+	}
+}
+
 func execTemplateLog(t *template.Template, w io.Writer, data interface{}, log *logrus.Entry) {
 	if err := t.Execute(w, data); err != nil {
 		log.WithError(err).Error("error executing html template")
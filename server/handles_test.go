@@ -0,0 +1,512 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/segmentio/ksuid"
+	"github.com/spf13/viper"
+	"wuyrush.io/pin/common/pinid"
+	cst "wuyrush.io/pin/constants"
+	"wuyrush.io/pin/email"
+	pe "wuyrush.io/pin/errors"
+	md "wuyrush.io/pin/models"
+	st "wuyrush.io/pin/stores"
+	"wuyrush.io/pin/webhook"
+)
+
+// faultyPinStore keeps pins in memory and fails the calls configured in errs
+type faultyPinStore struct {
+	st.PinStore
+	errs       map[string]*pe.PinErr
+	registered map[string]bool
+	saved      map[string]*md.Pin
+}
+
+func (s *faultyPinStore) Register(ctx context.Context, p *md.Pin) *pe.PinErr {
+	if err := s.errs["Register"]; err != nil {
+		return err
+	}
+	s.registered[p.ID] = true
+	return nil
+}
+
+func (s *faultyPinStore) Deregister(ctx context.Context, pinID string) *pe.PinErr {
+	if err := s.errs["Deregister"]; err != nil {
+		return err
+	}
+	delete(s.registered, pinID)
+	return nil
+}
+
+func (s *faultyPinStore) Save(ctx context.Context, p *md.Pin) *pe.PinErr {
+	if err := s.errs["Save"]; err != nil {
+		return err
+	}
+	s.saved[p.ID] = p
+	return nil
+}
+
+func (s *faultyPinStore) Delete(ctx context.Context, pinID string) *pe.PinErr {
+	if err := s.errs["Delete"]; err != nil {
+		return err
+	}
+	delete(s.saved, pinID)
+	return nil
+}
+
+// faultyFileStore keeps files in memory and fails saving the files named in errs
+type faultyFileStore struct {
+	st.FileStore
+	errs  map[string]*pe.PinErr
+	files map[string][]byte
+}
+
+func (fs *faultyFileStore) Ref(pinID, filename string) string {
+	return path.Join(pinID, filename)
+}
+
+func (fs *faultyFileStore) Save(ctx context.Context, ref string, r io.ReadCloser) *pe.PinErr {
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return pe.ErrServiceFailure("error reading file").WithCause(err)
+	}
+	// store partial data before failing, as an interrupted write would do
+	fs.files[ref] = data[:len(data)/2]
+	if err := fs.errs[path.Base(ref)]; err != nil {
+		return err
+	}
+	fs.files[ref] = data
+	return nil
+}
+
+func (fs *faultyFileStore) Delete(ctx context.Context, ref string) *pe.PinErr {
+	delete(fs.files, ref)
+	return nil
+}
+
+// fileHeaders builds multipart file headers of attachments with the given filenames
+func fileHeaders(t *testing.T, filenames ...string) []*multipart.FileHeader {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for _, fn := range filenames {
+		fw, err := mw.CreateFormFile("attachments", fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write([]byte("content of " + fn)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	form, err := multipart.NewReader(&buf, mw.Boundary()).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return form.File["attachments"]
+}
+
+func TestCreatePin(t *testing.T) {
+	filenames := []string{"a.txt", "b.txt", "c.txt"}
+	tcs := []struct {
+		name     string
+		psErrs   map[string]*pe.PinErr
+		fsErrs   map[string]*pe.PinErr
+		expected pe.ErrCode // empty if creation succeeds
+	}{
+		{
+			name: "success",
+		},
+		{
+			name:     "register fails",
+			psErrs:   map[string]*pe.PinErr{"Register": pe.ErrServiceFailure("register failed")},
+			expected: pe.ErrCodeServiceFailure,
+		},
+		{
+			name:     "attachment fails",
+			fsErrs:   map[string]*pe.PinErr{"b.txt": pe.ErrServiceFailure("disk failed")},
+			expected: pe.ErrCodeServiceFailure,
+		},
+		{
+			name:     "attachment too large",
+			fsErrs:   map[string]*pe.PinErr{"c.txt": pe.ErrBadInput("file too large")},
+			expected: pe.ErrCodeAPIBadRequest,
+		},
+		{
+			name:     "metadata fails",
+			psErrs:   map[string]*pe.PinErr{"Save": pe.ErrServiceFailure("save failed")},
+			expected: pe.ErrCodeServiceFailure,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			ps := &faultyPinStore{errs: tc.psErrs, registered: map[string]bool{}, saved: map[string]*md.Pin{}}
+			fs := &faultyFileStore{errs: tc.fsErrs, files: map[string][]byte{}}
+			s := &pinServer{PS: ps, FS: fs}
+			p := &md.Pin{Attachments: map[string]string{}}
+			for _, fn := range filenames {
+				p.Attachments[fn] = ""
+			}
+			err := s.createPin(context.Background(), p, pinid.SchemeKsuid, fileHeaders(t, filenames...))
+			if tc.expected == "" {
+				if err != nil {
+					t.Fatalf("expected success, got %v", err)
+				}
+				if !ps.registered[p.ID] || ps.saved[p.ID] != p {
+					t.Errorf("expected pin %s registered and saved", p.ID)
+				}
+				for _, fn := range filenames {
+					if got, want := string(fs.files[p.Attachments[fn]]), "content of "+fn; got != want {
+						t.Errorf("expected attachment %s to have content %q, got %q", fn, want, got)
+					}
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if err.Code != tc.expected {
+				t.Errorf("expected error code %s, got %s", tc.expected, err.Code)
+			}
+			if len(ps.registered) != 0 || len(ps.saved) != 0 {
+				t.Errorf("expected no pin left, got registered %v and saved %v", ps.registered, ps.saved)
+			}
+			if len(fs.files) != 0 {
+				t.Errorf("expected no attachment left, got %d", len(fs.files))
+			}
+		})
+	}
+}
+
+func TestCreatePinRollbackFailure(t *testing.T) {
+	// pin stays registered for the deleter to clean up if rollback fails
+	ps := &faultyPinStore{
+		errs: map[string]*pe.PinErr{
+			"Save":   pe.ErrServiceFailure("save failed"),
+			"Delete": pe.ErrServiceFailure("delete failed"),
+		},
+		registered: map[string]bool{},
+		saved:      map[string]*md.Pin{},
+	}
+	fs := &faultyFileStore{files: map[string][]byte{}}
+	s := &pinServer{PS: ps, FS: fs}
+	p := &md.Pin{Attachments: map[string]string{"a.txt": ""}}
+	err := s.createPin(context.Background(), p, pinid.SchemeKsuid, fileHeaders(t, "a.txt"))
+	if err == nil || err.StatusCode() != http.StatusInternalServerError {
+		t.Fatalf("expected service failure, got %v", err)
+	}
+	if !ps.registered[p.ID] {
+		t.Errorf("expected pin %s to stay registered", p.ID)
+	}
+	if len(ps.saved) != 0 || len(fs.files) != 0 {
+		t.Errorf("expected no pin data left, got saved %v and files %v", ps.saved, fs.files)
+	}
+}
+
+// newTestServer sets up a pin server backed by in-memory stores
+func newTestServer(t *testing.T) (*pinServer, *st.MemoryStore, *st.MemoryFileStore) {
+	viper.Set(cst.EnvReqBodySizeMaxByte, 1<<20)
+	viper.Set(cst.EnvPinAttachmentSizeMaxByte, 1<<10)
+	ps, fs := st.NewMemoryStore(), st.NewMemoryFileStore()
+	s := &pinServer{PS: ps, FS: fs, ML: &email.Mailer{}, NT: webhook.NewNotifier(ps)}
+	s.SS = sessions.NewCookieStore([]byte("0123456789abcdef0123456789abcdef"))
+	s.HS, s.TH, s.AL, s.TS = ps, ps, ps, ps
+	s.SetupMux()
+	return s, ps, fs
+}
+
+// testClient carries session cookies and CSRF token across requests to a test server
+type testClient struct {
+	t       *testing.T
+	s       *pinServer
+	cookies []*http.Cookie
+	token   string
+}
+
+var reCSRFToken = regexp.MustCompile(`name="csrf-token" value="([0-9a-f]+)"`)
+
+func newTestClient(t *testing.T, s *pinServer) *testClient {
+	c := &testClient{t: t, s: s}
+	w := c.do(httptest.NewRequest(http.MethodGet, "/", nil))
+	m := reCSRFToken.FindStringSubmatch(w.Body.String())
+	if m == nil {
+		t.Fatalf("CSRF token not found in create pin page: %s", w.Body)
+	}
+	c.token = m[1]
+	return c
+}
+
+func (c *testClient) do(r *http.Request) *httptest.ResponseRecorder {
+	for _, ck := range c.cookies {
+		r.AddCookie(ck)
+	}
+	w := httptest.NewRecorder()
+	c.s.ServeHTTP(w, r)
+	if cks := w.Result().Cookies(); len(cks) > 0 {
+		c.cookies = cks
+	}
+	return w
+}
+
+func (c *testClient) get(url string) *httptest.ResponseRecorder {
+	return c.do(httptest.NewRequest(http.MethodGet, url, nil))
+}
+
+// createPin posts the pin creation form with the given fields and attachments
+func (c *testClient) createPin(fields map[string]string, attachments map[string]string) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	fields[csrfFormField] = c.token
+	for k, v := range fields {
+		if err := mw.WriteField(k, v); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+	for fn, content := range attachments {
+		fw, err := mw.CreateFormFile("attachments", fn)
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		if _, err := fw.Write([]byte(content)); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		c.t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/pin", &buf)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	return c.do(r)
+}
+
+var rePinID = regexp.MustCompile(`/pin/([^/"]+)/qr\.png`)
+
+// pinIDOf returns ID of the pin rendered in response w
+func pinIDOf(t *testing.T, w *httptest.ResponseRecorder) string {
+	m := rePinID.FindStringSubmatch(w.Body.String())
+	if m == nil {
+		t.Fatalf("pin ID not found in response: %s", w.Body)
+	}
+	return m[1]
+}
+
+func TestHandleCreateAndGetPin(t *testing.T) {
+	s, _, _ := newTestServer(t)
+	c := newTestClient(t, s)
+	w := c.createPin(map[string]string{"title": "groceries", "note": "milk", "good-for": "10m"},
+		map[string]string{"list.txt": "eggs"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d creating pin, got %d: %s", http.StatusOK, w.Code, w.Body)
+	}
+	id := pinIDOf(t, w)
+	w = c.get("/pin/" + id)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "groceries") {
+		t.Fatalf("expected pin rendered, got status %d: %s", w.Code, w.Body)
+	}
+	w = c.get("/pin/" + id + "/attachment/list.txt")
+	if w.Code != http.StatusOK || w.Body.String() != "eggs" {
+		t.Errorf("expected attachment content %q, got status %d: %s", "eggs", w.Code, w.Body)
+	}
+	if got := w.Header().Get("Content-Type"); got != "application/octet-stream" {
+		t.Errorf("expected attachment served as application/octet-stream, got %s", got)
+	}
+}
+
+func TestHandleGetReadAndBurnPin(t *testing.T) {
+	s, _, _ := newTestServer(t)
+	c := newTestClient(t, s)
+	w := c.createPin(map[string]string{"title": "secret", "good-for": "10m", "read-and-burn": "true"}, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d creating pin, got %d: %s", http.StatusOK, w.Code, w.Body)
+	}
+	id := pinIDOf(t, w)
+	if w := c.get("/pin/" + id); w.Code != http.StatusOK {
+		t.Fatalf("expected status %d viewing pin for the first time, got %d", http.StatusOK, w.Code)
+	}
+	if w := c.get("/pin/" + id); w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d viewing burnt pin, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestHandleGetExpiredPin(t *testing.T) {
+	s, ps, _ := newTestServer(t)
+	c := newTestClient(t, s)
+	p := &md.Pin{ID: ksuid.New().String(), Title: "stale", CreationTime: time.Now().Add(-time.Hour),
+		GoodFor: time.Minute, Attachments: map[string]string{}}
+	if err := ps.Save(context.Background(), p); err != nil {
+		t.Fatal(err)
+	}
+	if w := c.get("/pin/" + p.ID); w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d viewing expired pin, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestHandleCreatePinRejected(t *testing.T) {
+	tcs := []struct {
+		name        string
+		fields      map[string]string
+		attachments map[string]string
+		noToken     bool
+		expected    int
+	}{
+		{
+			name:     "missing CSRF token",
+			fields:   map[string]string{"good-for": "10m"},
+			noToken:  true,
+			expected: http.StatusForbidden,
+		},
+		{
+			name:     "invalid good-for period",
+			fields:   map[string]string{"good-for": "forever"},
+			expected: http.StatusBadRequest,
+		},
+		{
+			name:        "oversized attachment",
+			fields:      map[string]string{"good-for": "10m"},
+			attachments: map[string]string{"big.txt": strings.Repeat("x", 2<<10)},
+			expected:    http.StatusBadRequest,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			s, _, fs := newTestServer(t)
+			c := newTestClient(t, s)
+			if tc.noToken {
+				c.token = ""
+			}
+			if w := c.createPin(tc.fields, tc.attachments); w.Code != tc.expected {
+				t.Errorf("expected status %d, got %d: %s", tc.expected, w.Code, w.Body)
+			}
+			// attachments of rejected requests are never kept
+			files := 0
+			fs.Walk(context.Background(), func(pinID, ref string, modTime time.Time) error {
+				files++
+				return nil
+			})
+			if files != 0 {
+				t.Errorf("expected no attachment left, got %d", files)
+			}
+		})
+	}
+}
+
+func TestHandleRateLimit(t *testing.T) {
+	viper.Set(cst.EnvRateLimitAnonymous, 1)
+	viper.Set(cst.EnvRateLimitToken, 2)
+	defer viper.Set(cst.EnvRateLimitAnonymous, 0)
+	defer viper.Set(cst.EnvRateLimitToken, 0)
+	s, ps, _ := newTestServer(t)
+	// the client has used up its anonymous quota fetching CSRF token
+	c := newTestClient(t, s)
+	w := c.get("/")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("expected anonymous requester rate limited with Retry-After, got status %d, %v", w.Code, w.Header())
+	}
+	if w := c.get("/healthz"); w.Code == http.StatusTooManyRequests {
+		t.Error("expected probes exempted from rate limits")
+	}
+	// requests bearing API token are counted towards the token quota instead
+	if err := ps.SaveToken(context.Background(), "t0ken", &md.User{ID: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	for i, expected := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Authorization", "Bearer t0ken")
+		if w := c.do(r); w.Code != expected {
+			t.Errorf("expected status %d of request %d bearing API token, got %d", expected, i, w.Code)
+		}
+	}
+}
+
+func TestHandleCSRFExemptsAPIToken(t *testing.T) {
+	s, ps, _ := newTestServer(t)
+	if err := ps.SaveToken(context.Background(), "t0ken", &md.User{ID: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	body := `{"url": "https://203.0.113.7/hook", "events": ["pin.viewed"]}`
+	r := httptest.NewRequest(http.MethodPost, "/api/webhooks", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Authorization", "Bearer t0ken")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	if w.Code != http.StatusCreated {
+		t.Errorf("expected webhook created by API token without CSRF token, got status %d: %s", w.Code, w.Body)
+	}
+	// requests without API token still need CSRF token
+	r = httptest.NewRequest(http.MethodPost, "/api/webhooks", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected status %d without CSRF token, got %d", http.StatusForbidden, w.Code)
+	}
+}
+
+func TestHandleCreatePinRemovesTempFiles(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "pin-tmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	defer os.Setenv("TMPDIR", os.Getenv("TMPDIR"))
+	os.Setenv("TMPDIR", tmp)
+	s, _, _ := newTestServer(t)
+	c := newTestClient(t, s)
+	// net/http cleans up after the request it hands to the outermost handler only, hence a real server
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	for _, tokenInHeader := range []bool{false, true} {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		mw.WriteField("good-for", "10m")
+		if !tokenInHeader {
+			mw.WriteField(csrfFormField, c.token)
+		}
+		// attachments larger than the in-memory part of multipart forms are spooled to TMPDIR
+		fw, err := mw.CreateFormFile("attachments", "big.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(strings.Repeat("x", 512)))
+		mw.Close()
+		r, err := http.NewRequest(http.MethodPost, srv.URL+"/pin", &buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Header.Set("Content-Type", mw.FormDataContentType())
+		if tokenInHeader {
+			r.Header.Set(csrfHeader, c.token)
+		}
+		for _, ck := range c.cookies {
+			r.AddCookie(ck)
+		}
+		resp, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status %d creating pin, got %d", http.StatusOK, resp.StatusCode)
+		}
+		if fis, err := ioutil.ReadDir(tmp); err != nil || len(fis) != 0 {
+			t.Errorf("expected no temporary file left with CSRF token in header: %t, got %d, %v",
+				tokenInHeader, len(fis), err)
+		}
+	}
+}
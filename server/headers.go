@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+
+	"github.com/spf13/viper"
+	"wuyrush.io/pin/common/logging"
+	cst "wuyrush.io/pin/constants"
+)
+
+const (
+	cspNonceSize = 16
+	hstsMaxAge   = 365 * 24 * 60 * 60 // in seconds
+	// cspTmpl allows scripts carrying the per-request nonce only, and everything else from the service itself
+	cspTmpl = "default-src 'self'; script-src 'nonce-%s'; object-src 'none'; base-uri 'none'; " +
+		"form-action 'self'; frame-ancestors 'none'"
+	// cspAttachment is the policy of attachment responses. Attachments are user supplied content, hence are
+	// sandboxed and not allowed to load anything in case browsers render them in spite of Content-Disposition
+	cspAttachment = "sandbox; default-src 'none'"
+)
+
+// HandleSecurityHeaders is a middleware setting security related response headers for all requests. It
+// generates a CSP nonce per request, which templates embed into their inline scripts via cspNonce()
+func (s *pinServer) HandleSecurityHeaders(h http.Handler) http.Handler {
+	clog := logging.WithFuncName()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clog := clog.WithContext(r.Context())
+		b := make([]byte, cspNonceSize)
+		if _, err := rand.Read(b); err != nil {
+			clog.WithError(err).Error("error generating CSP nonce")
+			http.Error(w, "error generating CSP nonce", http.StatusInternalServerError)
+			return
+		}
+		nonce := base64.StdEncoding.EncodeToString(b)
+		headers := w.Header()
+		headers.Set("Content-Security-Policy", fmt.Sprintf(cspTmpl, nonce))
+		headers.Set("X-Content-Type-Options", "nosniff")
+		headers.Set("X-Frame-Options", "DENY")
+		// pin urls are the only secrets guarding public pins, so never leak them to other sites
+		headers.Set("Referrer-Policy", "no-referrer")
+		if r.TLS != nil || viper.GetBool(cst.EnvHSTS) {
+			headers.Set("Strict-Transport-Security", fmt.Sprintf("max-age=%d; includeSubDomains", hstsMaxAge))
+		}
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKeyCSPNonce, nonce)))
+	})
+}
+
+// cspNonce returns the CSP nonce of request r
+func cspNonce(r *http.Request) string {
+	nonce, _ := r.Context().Value(ctxKeyCSPNonce).(string)
+	return nonce
+}
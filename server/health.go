@@ -0,0 +1,52 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/julienschmidt/httprouter"
+	"wuyrush.io/pin/common/logging"
+)
+
+// glob of html templates the server renders
+const tmplGlob = "templates/*.html"
+
+// HandleHealthz reports liveness of the server, i.e. the server is able to handle requests at all
+func (s *pinServer) HandleHealthz() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte("ok"))
+	}
+}
+
+// HandleReadyz reports readiness of the server, i.e. its dependencies are healthy so that it can serve traffic.
+// It responds with results of individual checks, along with 503 if any of them fails. Handlers render templates
+// parsed upon setup, hence templates are checked once upon setup as well rather than upon every probe
+func (s *pinServer) HandleReadyz() httprouter.Handle {
+	clog := logging.WithFuncName()
+	_, tmplErr := template.ParseGlob(tmplGlob)
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		clog := clog.WithContext(r.Context())
+		// let load balancers take the server out of rotation while it drains in-flight requests
+		if atomic.LoadInt32(&s.draining) == 1 {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]string{"server": "draining"}, clog)
+			return
+		}
+		code, res := http.StatusOK, map[string]string{"pinStore": "ok", "fileStore": "ok", "templates": "ok"}
+		fail := func(check string, err error) {
+			clog.WithError(err).WithField("check", check).Warn("readiness check failed")
+			code, res[check] = http.StatusServiceUnavailable, err.Error()
+		}
+		if err := s.PS.Ping(r.Context()); err != nil {
+			fail("pinStore", err)
+		}
+		if err := s.FS.Ping(r.Context()); err != nil {
+			fail("fileStore", err)
+		}
+		if tmplErr != nil {
+			fail("templates", tmplErr)
+		}
+		writeJSON(w, code, res, clog)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"wuyrush.io/pin/common/logging"
+	"wuyrush.io/pin/common/metrics"
+)
+
+// HandleMetrics is a middleware recording latency of requests to the given route. route shall be the path
+// pattern h is registered with rather than the request path, so as to bound cardinality of the metrics
+func (s *pinServer) HandleMetrics(route string, h httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		start := time.Now()
+		sr := &statusRecorder{ResponseWriter: w}
+		h(sr, r, ps)
+		if sr.status == 0 {
+			sr.status = http.StatusOK
+		}
+		metrics.RequestDuration.WithLabelValues(route, r.Method, strconv.Itoa(sr.status)).
+			Observe(time.Since(start).Seconds())
+	}
+}
+
+// serveMetrics serves metrics at the given address, apart from the public application port
+func serveMetrics(addr string) {
+	clog := logging.WithFuncName().WithField("addr", addr)
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	clog.Info("serving metrics")
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		clog.WithError(err).Error("error serving metrics")
+	}
+}
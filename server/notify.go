@@ -0,0 +1,122 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"wuyrush.io/pin/common/logging"
+	cst "wuyrush.io/pin/constants"
+	"wuyrush.io/pin/email"
+	md "wuyrush.io/pin/models"
+)
+
+const defaultViewNoticeThrottle = time.Minute
+
+// noticeView emails pin owner about a view of the pin per the pin's view notice setting. Notices of a pin are
+// throttled to at most one per throttle period so that a popular pin cannot flood the owner's inbox; views
+// happening during the period are not noticed. Emails are sent in background, which shutdown waits for
+func (s *pinServer) noticeView(r *http.Request, p *md.Pin) {
+	clog := logging.WithFuncName().WithContext(r.Context()).WithField("pinID", p.ID)
+	switch {
+	case p.NotifyAddr == "" || p.NotifyOnView == md.ViewNoticeNone:
+		return
+	case p.NotifyOnView == md.ViewNoticeFirst && p.ViewCount != 1:
+		return
+	}
+	addr := viper.GetString(cst.EnvSMTPAddr)
+	if addr == "" {
+		clog.Debug("smtp server not configured. Skip view notice")
+		return
+	}
+	throttle := viper.GetDuration(cst.EnvViewNoticeThrottle)
+	if throttle <= 0 {
+		throttle = defaultViewNoticeThrottle
+	}
+	ok, err := s.TH.Acquire(r.Context(), "viewnotice."+p.ID, throttle)
+	if err != nil {
+		clog.WithError(err).Error("error throttling view notice")
+		return
+	}
+	if !ok {
+		clog.Debug("view notice throttled")
+		return
+	}
+	from, perr := mail.ParseAddress(viper.GetString(cst.EnvMailFrom))
+	if perr != nil {
+		clog.WithError(perr).Error("invalid sender email address")
+		return
+	}
+	host, _, _ := net.SplitHostPort(addr)
+	m := &email.Mail{
+		Addr:        addr,
+		From:        *from,
+		To:          []mail.Address{{Address: p.NotifyAddr}},
+		Subj:        fmt.Sprintf("Your pin %q was viewed", p.Title),
+		ContentType: "text/plain; charset=utf-8",
+		Content: fmt.Sprintf("Your pin %s (%q) was viewed at %s.\r\n\r\n"+
+			"Viewer fingerprint: %s\r\n"+
+			"The fingerprint is derived from the viewer's network and browser; identical fingerprints likely mean "+
+			"the same viewer.\r\n",
+			p.ID, p.Title, time.Now().UTC().Format(time.RFC1123), viewerFingerprint(r)),
+		Auth: smtp.PlainAuth("", viper.GetString(cst.EnvSMTPUser), viper.GetString(cst.EnvSMTPPasswd), host),
+	}
+	s.notices.Add(1)
+	go func() {
+		defer s.notices.Done()
+		if err := s.ML.Send(m); err != nil {
+			clog.WithError(err).Error("error sending view notice")
+			return
+		}
+		clog.Info("view notice sent")
+	}()
+}
+
+// clientIP returns IP address of the peer issuing request r. When the server sits behind a trusted reverse proxy,
+// the address is taken from the last entry of X-Forwarded-For header, which is appended by the proxy
+func clientIP(r *http.Request) net.IP {
+	if viper.GetBool(cst.EnvTrustProxy) {
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			addrs := strings.Split(xff, ",")
+			if ip := net.ParseIP(strings.TrimSpace(addrs[len(addrs)-1])); ip != nil {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// clientAddr returns the IP address of the peer issuing request r in string form. Peers whose address cannot
+// be parsed are told apart by their raw remote address instead
+func clientAddr(r *http.Request) string {
+	if ip := clientIP(r); ip != nil {
+		return ip.String()
+	}
+	return r.RemoteAddr
+}
+
+// viewerFingerprint returns a coarse, non-reversible fingerprint of the requester, derived from their network
+// prefix(/24 for IPv4 and /48 for IPv6) and user agent
+func viewerFingerprint(r *http.Request) string {
+	var network string
+	if ip := clientIP(r); ip != nil {
+		if v4 := ip.To4(); v4 != nil {
+			network = v4.Mask(net.CIDRMask(24, 32)).String()
+		} else {
+			network = ip.Mask(net.CIDRMask(48, 128)).String()
+		}
+	}
+	sum := sha256.Sum256([]byte(network + "|" + r.UserAgent()))
+	return hex.EncodeToString(sum[:])[:12]
+}
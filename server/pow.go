@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/spf13/viper"
+	"wuyrush.io/pin/common/logging"
+	"wuyrush.io/pin/common/pow"
+	cst "wuyrush.io/pin/constants"
+	pe "wuyrush.io/pin/errors"
+	md "wuyrush.io/pin/models"
+)
+
+const (
+	defaultPoWDifficulty    = 16
+	defaultPoWMaxDifficulty = 24
+	defaultPoWLoadThreshold = 60
+	defaultPoWChallengeTTL  = 5 * time.Minute
+	// anonymous pin creation load is measured in windows of this size
+	powLoadWindow = time.Minute
+	powLoadKey    = "pow.load"
+)
+
+// powRequired reports whether requester of r must solve a proof-of-work challenge before creating pin
+func (s *pinServer) powRequired(r *http.Request) bool {
+	return viper.GetBool(cst.EnvPoWEnabled) && s.currentUser(r).Anonymous()
+}
+
+// powDifficulty scales the base difficulty with recent load of anonymous pin creation - it adds one bit per
+// doubling of the load beyond the configured threshold, up to the configured max difficulty
+func (s *pinServer) powDifficulty(ctx context.Context) int {
+	base, max := viper.GetInt(cst.EnvPoWDifficulty), viper.GetInt(cst.EnvPoWMaxDifficulty)
+	if base <= 0 {
+		base = defaultPoWDifficulty
+	}
+	if max <= 0 || max > pow.MaxDifficulty {
+		max = defaultPoWMaxDifficulty
+	}
+	threshold := viper.GetInt64(cst.EnvPoWLoadThreshold)
+	if threshold <= 0 {
+		threshold = defaultPoWLoadThreshold
+	}
+	load, err := s.TH.Count(ctx, powLoadKey, 0, powLoadWindow)
+	if err != nil {
+		logging.WithFuncName().WithContext(ctx).WithError(err).Error("error getting pin creation load. Using base difficulty")
+		return base
+	}
+	d := base
+	for l := load; l > threshold && d < max; l /= 2 {
+		d++
+	}
+	return d
+}
+
+func powChallengeTTL() time.Duration {
+	if ttl := viper.GetDuration(cst.EnvPoWChallengeTTL); ttl > 0 {
+		return ttl
+	}
+	return defaultPoWChallengeTTL
+}
+
+// verifyPoW checks the proof-of-work solution carried by pin creation request r, if the requester is required
+// to provide one. Challenges are single-use
+func (s *pinServer) verifyPoW(r *http.Request) *pe.PinErr {
+	if !s.powRequired(r) {
+		return nil
+	}
+	clog := logging.WithFuncName().WithContext(r.Context())
+	if _, err := s.TH.Count(r.Context(), powLoadKey, 1, powLoadWindow); err != nil {
+		clog.WithError(err).Error("error counting pin creation load")
+	}
+	ttl := powChallengeTTL()
+	c, err := pow.Verify([]byte(viper.GetString(cst.EnvPoWKey)), r.FormValue("pow-challenge"),
+		r.FormValue("pow-solution"), clientAddr(r), ttl, time.Now())
+	if err != nil {
+		return pe.ErrBadInput("proof-of-work verification failed. Please retry").WithCause(err)
+	}
+	ok, perr := s.TH.Acquire(r.Context(), "pow."+c.Nonce, ttl)
+	if perr != nil {
+		return perr
+	}
+	if !ok {
+		return pe.ErrBadInput("proof-of-work challenge had been used. Please retry")
+	}
+	return nil
+}
+
+// createPinView assembles data to render create pin page with, including a fresh proof-of-work challenge if
+// required. Both p and msg are optional
+func (s *pinServer) createPinView(r *http.Request, p *md.Pin, msg string) md.PinView {
+	pv := md.PinView{Err: msg, CSRFToken: csrfToken(r), CSPNonce: cspNonce(r)}
+	if p != nil {
+		pv.Pin = *p
+	}
+	if s.powRequired(r) {
+		d := s.powDifficulty(r.Context())
+		c, err := pow.Issue([]byte(viper.GetString(cst.EnvPoWKey)), clientAddr(r), d, time.Now())
+		if err != nil {
+			logging.WithFuncName().WithContext(r.Context()).WithError(err).Error("error issuing proof-of-work challenge")
+			return pv
+		}
+		pv.PoWChallenge, pv.PoWDifficulty = c, d
+	}
+	return pv
+}
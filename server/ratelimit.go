@@ -0,0 +1,120 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"wuyrush.io/pin/common/logging"
+	cst "wuyrush.io/pin/constants"
+)
+
+// rate limit scopes. Each scope has quotas of its own
+const (
+	rateLimitScopeDefault = "default"
+	rateLimitScopeCreate  = "create"
+)
+
+// requester tiers, each of which has quotas of its own
+const (
+	tierAnonymous = "anonymous"
+	tierUser      = "user"
+	tierToken     = "token"
+)
+
+const defaultRateLimitWindow = time.Minute
+
+// env vars of rate limits by scope and tier
+var rateLimitEnvs = map[string]map[string]string{
+	rateLimitScopeDefault: {
+		tierAnonymous: cst.EnvRateLimitAnonymous,
+		tierUser:      cst.EnvRateLimitUser,
+		tierToken:     cst.EnvRateLimitToken,
+	},
+	rateLimitScopeCreate: {
+		tierAnonymous: cst.EnvRateLimitCreateAnonymous,
+		tierUser:      cst.EnvRateLimitCreateUser,
+		tierToken:     cst.EnvRateLimitCreateToken,
+	},
+}
+
+// HandleRateLimit is a middleware for rate limiting. Requesters are told apart by API token, logged in user or
+// IP address, in that order, and get quotas of their tier in the scope of the request. It runs ahead of anything
+// reading request body, so that rate limited requests never get their body spooled to disk. Quotas are tracked
+// in Throttler so that they hold across server replicas. Requests are let through if Throttler fails
+func (s *pinServer) HandleRateLimit(h http.Handler) http.Handler {
+	clog := logging.WithFuncName()
+	window := viper.GetDuration(cst.EnvRateLimitWindow)
+	if window <= 0 {
+		window = defaultRateLimitWindow
+	}
+	limits := map[string]map[string]int{}
+	for scope, envs := range rateLimitEnvs {
+		limits[scope] = map[string]int{}
+		for tier, env := range envs {
+			limits[scope][tier] = viper.GetInt(env)
+		}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scope := rateLimitScope(r)
+		if scope == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		tier, id := s.requester(r)
+		limit := limits[scope][tier]
+		if limit <= 0 {
+			h.ServeHTTP(w, r)
+			return
+		}
+		key := fmt.Sprintf("ratelimit.%s.%s.%s", scope, tier, id)
+		rlog := clog.WithContext(r.Context()).WithFields(logrus.Fields{"scope": scope, "tier": tier, "key": key})
+		ok, wait, err := s.TH.Allow(r.Context(), key, limit, window)
+		if err != nil {
+			rlog.WithError(err).Error("error rate limiting request. Letting it through")
+			h.ServeHTTP(w, r)
+			return
+		}
+		if !ok {
+			rlog.WithField("retryAfter", wait).Warn("request rate limited")
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// rateLimitScope returns the rate limit scope of request r, or empty string if r is not rate limited, e.g.
+// probes of orchestrators and static assets
+func rateLimitScope(r *http.Request) string {
+	switch {
+	case r.URL.Path == "/healthz" || r.URL.Path == "/readyz" || strings.HasPrefix(r.URL.Path, "/static/"):
+		return ""
+	case r.Method == http.MethodPost && (r.URL.Path == "/" || r.URL.Path == "/pin"):
+		return rateLimitScopeCreate
+	default:
+		return rateLimitScopeDefault
+	}
+}
+
+// requester returns the tier of the requester issuing request r along with their identifier in the tier
+func (s *pinServer) requester(r *http.Request) (string, string) {
+	u := s.currentUser(r)
+	switch {
+	case u.Anonymous():
+		return tierAnonymous, clientAddr(r)
+	case bearerToken(r) != "":
+		sum := sha256.Sum256([]byte(bearerToken(r)))
+		return tierToken, hex.EncodeToString(sum[:])
+	default:
+		return tierUser, u.ID
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/segmentio/ksuid"
+	"github.com/sirupsen/logrus"
+	"wuyrush.io/pin/common/logging"
+)
+
+const (
+	headerRequestID = "X-Request-ID"
+	// request IDs propagated from clients are honored up to this size
+	maxRequestIDSize = 128
+)
+
+// statusRecorder records the status code and size of the response written through it
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (sr *statusRecorder) WriteHeader(code int) {
+	if sr.status == 0 {
+		sr.status = code
+	}
+	sr.ResponseWriter.WriteHeader(code)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	n, err := sr.ResponseWriter.Write(b)
+	sr.bytes += int64(n)
+	return n, err
+}
+
+// HandleRequestLog is a middleware tying up log entries of a request with a request ID. It propagates the
+// request ID carried by the request if any, or assigns a new one otherwise. The request ID is echoed back in
+// response header, and put into request context so that entries logged with the context carry it. Every
+// request is logged in one access log entry once handled
+func (s *pinServer) HandleRequestLog(h http.Handler) http.Handler {
+	clog := logging.WithFuncName()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get(headerRequestID)
+		if !validRequestID(id) {
+			id = ksuid.New().String()
+		}
+		w.Header().Set(headerRequestID, id)
+		r = r.WithContext(logging.NewContext(r.Context(), id))
+		sr := &statusRecorder{ResponseWriter: w}
+		h.ServeHTTP(sr, r)
+		if sr.status == 0 {
+			sr.status = http.StatusOK
+		}
+		clog.WithContext(r.Context()).WithFields(logrus.Fields{
+			"httpMethod":    r.Method,
+			"path":          r.URL.Path,
+			"status":        sr.status,
+			"bytes":         sr.bytes,
+			"latencyMillis": time.Since(start).Milliseconds(),
+			"remoteIP":      clientAddr(r),
+			"userAgent":     r.UserAgent(),
+		}).Info("request handled")
+	})
+}
+
+// validRequestID reports whether the request ID propagated from client is safe to log and echo back
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDSize {
+		return false
+	}
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -9,22 +9,40 @@ import (
 // set up routes
 func (s *pinServer) SetupMux() {
 	r := httprouter.New()
-	r.GET("/", s.HandleTaskGetCreatePinPage())
-	r.GET("/pin", s.HandleTaskGetCreatePinPage())
-	r.POST("/", s.HandleTaskCreatePin())
-	r.POST("/pin", s.HandleTaskCreatePin())
-	r.GET("/pin/:id", s.HandleTaskGetPin())
-	r.GET("/pins/anonymous", s.HandleTaskListAnonymousPins())
-	r.GET("/pins/user", s.HandleTaskListUserPins())
-	r.DELETE("/pin/:id", s.HandleTaskDeletePin())
-	r.GET("/pin/:id/attachment/:filename", s.HandleTaskGetPinAttachment())
+	// route registers h with the given method and path, instrumented with request metrics
+	route := func(method, path string, h httprouter.Handle) {
+		r.Handle(method, path, s.HandleMetrics(path, h))
+	}
+	route(http.MethodGet, "/", s.HandleTaskGetCreatePinPage())
+	route(http.MethodGet, "/pin", s.HandleTaskGetCreatePinPage())
+	route(http.MethodPost, "/", s.HandleTaskCreatePin())
+	route(http.MethodPost, "/pin", s.HandleTaskCreatePin())
+	route(http.MethodGet, "/pin/:id", s.HandleTaskGetPin())
+	route(http.MethodGet, "/pins/anonymous", s.HandleTaskListAnonymousPins())
+	route(http.MethodGet, "/pins/user", s.HandleTaskListUserPins())
+	route(http.MethodDelete, "/pin/:id", s.HandleTaskDeletePin())
+	route(http.MethodGet, "/pin/:id/attachment/:filename", s.HandleTaskGetPinAttachment())
+	route(http.MethodGet, "/pin/:id/qr.png", s.HandleTaskGetPinQRCode())
+	route(http.MethodPost, "/pin/:id/extend", s.HandleTaskExtendPin())
+	route(http.MethodGet, "/pin/:id/access", s.HandleTaskGetPinAccessLog())
+	route(http.MethodGet, "/api/pin/:id/access", s.HandleAPIGetPinAccessLog())
+	// webhooks
+	route(http.MethodGet, "/api/webhooks", s.HandleTaskListWebhooks())
+	route(http.MethodPost, "/api/webhooks", s.HandleTaskCreateWebhook())
+	route(http.MethodDelete, "/api/webhooks/:hookID", s.HandleTaskDeleteWebhook())
+	route(http.MethodGet, "/api/webhooks/:hookID/deliveries", s.HandleTaskListWebhookDeliveries())
+	// API tokens
+	route(http.MethodPost, "/api/tokens", s.HandleTaskCreateToken())
+	route(http.MethodDelete, "/api/tokens", s.HandleTaskRevokeToken())
 	// user related
-	r.GET("/register", s.HandleTaskRegister())
-	r.POST("/register", s.HandleTaskRegister())
-	r.GET("/profile", s.HandleTaskGetUserProfile())
-	r.GET("/login", s.HandleAuthLogin())
-	r.POST("/login", s.HandleAuthLogin())
-	r.POST("/logout", s.HandleAuthLogout())
+	route(http.MethodGet, "/register", s.HandleTaskRegister())
+	route(http.MethodPost, "/register", s.HandleTaskRegister())
+	route(http.MethodGet, "/profile", s.HandleTaskGetUserProfile())
+	route(http.MethodGet, "/login", s.HandleAuthLogin())
+	route(http.MethodPost, "/login", s.HandleAuthLogin())
+	route(http.MethodPost, "/logout", s.HandleAuthLogout())
+	r.GET("/healthz", s.HandleHealthz())
+	r.GET("/readyz", s.HandleReadyz())
 	// static assets
 	r.Handler(
 		http.MethodGet,
@@ -33,4 +51,6 @@ func (s *pinServer) SetupMux() {
 	)
 
 	s.Router = r
+	// requests are rate limited ahead of CSRF checks, which read request body
+	s.handler = s.HandleRequestLog(s.HandleSecurityHeaders(s.HandleUser(s.HandleRateLimit(s.HandleCSRF(r)))))
 }
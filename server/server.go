@@ -1,21 +1,42 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/go-redis/redis"
+	_ "github.com/go-sql-driver/mysql"
 	"github.com/gorilla/sessions"
 	"github.com/julienschmidt/httprouter"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 	"wuyrush.io/pin/common/logging"
+	"wuyrush.io/pin/common/metrics"
 	rt "wuyrush.io/pin/common/retry"
 	cst "wuyrush.io/pin/constants"
+	"wuyrush.io/pin/deleter"
 	"wuyrush.io/pin/email"
 	pe "wuyrush.io/pin/errors"
 	st "wuyrush.io/pin/stores"
+	"wuyrush.io/pin/webhook"
+)
+
+const (
+	// name of the session tracking logged in users
+	sessName = "pin-session"
+	// session value key of the logged in user's ID
+	sessKeyUserID = "userID"
+	// session value key of the logged in user's email address
+	sessKeyEmail = "email"
 )
 
 // a combination of web and application server since it serves both application logic and web page rendering
@@ -23,12 +44,23 @@ type pinServer struct {
 	PS     st.PinStore
 	FS     st.FileStore
 	Router *httprouter.Router
-	SS     sessions.Store
-	ML     *email.Mailer
+	// handler wraps Router with middlewares applying to all requests
+	handler http.Handler
+	SS      sessions.Store
+	ML      *email.Mailer
+	HS      st.WebhookStore
+	NT      *webhook.Notifier
+	TH      st.Throttler
+	AL      st.AccessLogStore
+	TS      st.TokenStore
+	// draining is set to 1 once the server starts shutting down, accessed atomically
+	draining int32
+	// notices tracks view notices being sent in background
+	notices sync.WaitGroup
 }
 
 func (s *pinServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	s.Router.ServeHTTP(w, r)
+	s.handler.ServeHTTP(w, r)
 }
 
 // start up application server and serve incoming requests
@@ -36,6 +68,14 @@ func serve() error {
 	// read configuration from env vars
 	viper.AutomaticEnv()
 	logging.SetupLog("PinServer")
+	metrics.RegisterServer()
+	if viper.GetBool(cst.EnvPoWEnabled) && viper.GetString(cst.EnvPoWKey) == "" {
+		return pe.ErrBadInput(fmt.Sprintf("%s must be set to enable proof-of-work challenges", cst.EnvPoWKey))
+	}
+	// IP addresses are few enough to be recovered from their hashes unless keyed by a secret
+	if viper.GetString(cst.EnvAccessLogSalt) == "" {
+		return pe.ErrBadInput(fmt.Sprintf("%s must be set to hash IP addresses in access logs", cst.EnvAccessLogSalt))
+	}
 	// initialize dependencies in data layer
 	// NOTE docker compose's depends_on feature only guarantee the startup order of *service containers*,
 	// instead of the services themselves - It is us who define when the services are ready
@@ -54,21 +94,163 @@ func serve() error {
 		return err
 	}
 	ml := &email.Mailer{}
+	nt := webhook.NewNotifier(ps)
 	// TODO: close the session store when switch to Redis backend
 	svr := &pinServer{}
 	svr.PS, svr.FS, svr.SS, svr.ML = ps, fs, ss, ml
+	svr.HS, svr.NT, svr.TH, svr.AL, svr.TS = ps, nt, ps, ps, ps
 	svr.SetupMux()
+	// server fails upon failures of either itself or the embedded deleter
+	errChan := make(chan error, 2)
+	// the embedded deleter stops before stores are closed by deferred calls
+	if viper.GetBool(cst.EnvEmbeddedDeleter) {
+		stop := runDeleter(ps, fs, nt, errChan)
+		defer stop()
+	} else if viper.GetString(cst.EnvPinStore) == st.BackendBolt {
+		log.Warnf("%s not set. Junk pins are left in %s, which deleter cannot open from another process",
+			cst.EnvEmbeddedDeleter, st.BackendBolt)
+	}
 
 	host, port := viper.GetString(cst.EnvAppHost), viper.GetString(cst.EnvAppPort)
+	if mport := viper.GetString(cst.EnvMetricsPort); mport != "" {
+		go serveMetrics(fmt.Sprintf("%s:%s", host, mport))
+	} else {
+		log.Infof("%s not set. Metrics are not served", cst.EnvMetricsPort)
+	}
 	log.WithFields(log.Fields{
 		"host": host,
 		"port": port,
 	}).Infof("pin server is starting up")
-	addr := fmt.Sprintf("%s:%s", host, port)
-	return http.ListenAndServe(addr, svr)
+	hs := &http.Server{
+		Addr:              fmt.Sprintf("%s:%s", host, port),
+		Handler:           svr,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       durationOr(cst.EnvReadTimeout, defaultReadTimeout),
+		WriteTimeout:      durationOr(cst.EnvWriteTimeout, defaultWriteTimeout),
+		IdleTimeout:       idleTimeout,
+	}
+	go func() {
+		errChan <- hs.ListenAndServe()
+	}()
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT)
+	select {
+	case err := <-errChan:
+		return err
+	case sig := <-sigChan:
+		log.WithField("signal", sig).Info("got termination signal. Shutting down")
+	}
+	// stores are closed by deferred calls once in-flight requests are drained
+	return svr.shutdown(hs, viper.GetDuration(cst.EnvPreStopDelay),
+		durationOr(cst.EnvShutdownTimeout, defaultShutdownTimeout))
+}
+
+const (
+	readHeaderTimeout = 10 * time.Second
+	idleTimeout       = 2 * time.Minute
+	// read and write timeouts bound the time to upload and download attachments respectively
+	defaultReadTimeout     = 5 * time.Minute
+	defaultWriteTimeout    = 5 * time.Minute
+	defaultShutdownTimeout = 30 * time.Second
+)
+
+// durationOr returns the duration configured by env var env, or def if it is not set or non-positive
+func durationOr(env string, def time.Duration) time.Duration {
+	if d := viper.GetDuration(env); d > 0 {
+		return d
+	}
+	return def
 }
 
-func setupPinStore() (st.PinStore, error) {
+// shutdown marks the server as draining, keeps serving for delay so that load balancers notice the failing
+// readiness probe and stop routing requests to it, then stops hs from accepting new connections and waits up
+// to timeout for in-flight requests, view notices and pending webhook deliveries to finish
+func (s *pinServer) shutdown(hs *http.Server, delay, timeout time.Duration) error {
+	clog := logging.WithFuncName().WithFields(log.Fields{"delay": delay, "timeout": timeout})
+	atomic.StoreInt32(&s.draining, 1)
+	if delay > 0 {
+		clog.Info("server marked as draining. Waiting before shutting down")
+		time.Sleep(delay)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := hs.Shutdown(ctx); err != nil {
+		clog.WithError(err).Error("error draining in-flight requests")
+		return err
+	}
+	done := make(chan struct{})
+	go func() {
+		s.notices.Wait()
+		s.NT.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		clog.Warn("gave up waiting for pending view notices and webhook deliveries")
+	}
+	clog.Info("pin server shut down")
+	return nil
+}
+
+// setupPinStore sets up the PinStore backend selected by configuration, which defaults to Redis. The backend
+// serves as WebhookStore, Throttler, AccessLogStore and TokenStore as well
+func setupPinStore() (st.Store, error) {
+	switch b := viper.GetString(cst.EnvPinStore); b {
+	case "", st.BackendRedis:
+		s, err := setupRedisStore()
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	case st.BackendMemory:
+		log.Warnf("pin data is kept in memory, hence gone upon restart and visible to deleter embedded with %s only",
+			cst.EnvEmbeddedDeleter)
+		return st.NewMemoryStore(), nil
+	case st.BackendBolt:
+		dir := viper.GetString(cst.EnvDataDir)
+		if dir == "" {
+			return nil, pe.ErrBadInput(fmt.Sprintf("%s must be set to keep pin data in %s", cst.EnvDataDir, b))
+		}
+		s, err := st.NewBoltStore(dir)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	case st.BackendSQL:
+		s, err := st.OpenSQLStoreFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	default:
+		return nil, pe.ErrBadInput(fmt.Sprintf("unknown %s %q", cst.EnvPinStore, b))
+	}
+}
+
+// runDeleter runs deleter in the server process, which is the only way to dispose of junk pins in stores that
+// cannot be shared across processes. Deleter keeps running through failed sweeps, and sends the error to errChan
+// if it stops on its own. The returned function stops deleter and waits for it to finish in-flight deletions
+func runDeleter(ps st.PinStore, fs st.FileStore, nt *webhook.Notifier, errChan chan<- error) func() {
+	metrics.RegisterDeleter()
+	d := deleter.New(ps, fs, nt)
+	log.WithField("deleterID", d.ID()).Info("embedded deleter is starting up")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := d.Run(ctx); err != nil {
+			log.WithError(err).Error("error running embedded deleter")
+			errChan <- err
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func setupRedisStore() (*st.RedisStore, error) {
 	retryOpts := []rt.RetryOption{
 		rt.WithTimeout(3 * time.Second),
 		rt.WithBaseDelay(100 * time.Millisecond),
@@ -81,6 +263,7 @@ func setupPinStore() (st.PinStore, error) {
 		DB:         viper.GetInt(cst.EnvRedisDB),
 		MaxRetries: 3,
 	})
+	metrics.InstrumentRedis(redisClient)
 	// verify the client is up correctly
 	pingFn := func() error {
 		_, err := redisClient.Ping().Result()
@@ -92,8 +275,18 @@ func setupPinStore() (st.PinStore, error) {
 	return &st.RedisStore{DB: redisClient}, nil
 }
 
+// setupFileStore sets up the FileStore backend selected by configuration, which defaults to local file system
 func setupFileStore() (st.FileStore, error) {
-	return &st.LocalFileStore{}, nil
+	switch b := viper.GetString(cst.EnvFileStore); b {
+	case "", st.BackendLocal:
+		return &st.LocalFileStore{Root: viper.GetString(cst.EnvFileStoreRoot)}, nil
+	case st.BackendMemory:
+		log.Warnf("pin attachments are kept in memory, hence gone upon restart and visible to deleter embedded with %s only",
+			cst.EnvEmbeddedDeleter)
+		return st.NewMemoryFileStore(), nil
+	default:
+		return nil, pe.ErrBadInput(fmt.Sprintf("unknown %s %q", cst.EnvFileStore, b))
+	}
 }
 
 // returns concrete type so that we can leverage its specific functionalities besides fulfilling interface
@@ -101,8 +294,13 @@ func setupFileStore() (st.FileStore, error) {
 // store's own Close() method)
 // TODO: replace CookieStore to homemade Redis-backed store
 func setupSessionStore() (*sessions.CookieStore, error) {
-	return sessions.NewCookieStore(
+	ss := sessions.NewCookieStore(
 		[]byte(viper.GetString(cst.EnvSessAuthNKey)),
 		[]byte(viper.GetString(cst.EnvSessEncryptKey)),
-	), nil
+	)
+	// keep session cookie away from scripts and cross-site subrequests
+	ss.Options.HttpOnly = true
+	ss.Options.SameSite = http.SameSiteLaxMode
+	ss.Options.Secure = viper.GetBool(cst.EnvSessCookieSecure)
+	return ss, nil
 }
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"wuyrush.io/pin/common/logging"
+)
+
+const tokenSizeByte = 32
+
+// HandleTaskCreateToken issues an API token to the requester. The token is revealed in the response only
+func (s *pinServer) HandleTaskCreateToken() httprouter.Handle {
+	clog := logging.WithFuncName()
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		clog := clog.WithContext(r.Context())
+		u := s.currentUser(r)
+		if u.Anonymous() {
+			http.Error(w, "login required", http.StatusUnauthorized)
+			return
+		}
+		ulog := clog.WithField("userID", u.ID)
+		b := make([]byte, tokenSizeByte)
+		if _, err := rand.Read(b); err != nil {
+			ulog.WithError(err).Error("error generating API token")
+			http.Error(w, "error generating API token", http.StatusInternalServerError)
+			return
+		}
+		token := hex.EncodeToString(b)
+		if err := s.TS.SaveToken(r.Context(), token, u); err != nil {
+			ulog.WithError(err).Error("error saving API token")
+			http.Error(w, err.Error(), err.StatusCode())
+			return
+		}
+		ulog.Info("API token issued")
+		writeJSON(w, http.StatusCreated, map[string]string{"token": token}, ulog)
+	}
+}
+
+// HandleTaskRevokeToken revokes the API token carried by the request
+func (s *pinServer) HandleTaskRevokeToken() httprouter.Handle {
+	clog := logging.WithFuncName()
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		clog := clog.WithContext(r.Context())
+		token := bearerToken(r)
+		if token == "" {
+			http.Error(w, "API token required", http.StatusUnauthorized)
+			return
+		}
+		if err := s.TS.RevokeToken(r.Context(), token); err != nil {
+			clog.WithError(err).Error("error revoking API token")
+			http.Error(w, err.Error(), err.StatusCode())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
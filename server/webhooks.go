@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"wuyrush.io/pin/common/logging"
+	md "wuyrush.io/pin/models"
+	"wuyrush.io/pin/webhook"
+)
+
+// HandleTaskListWebhooks lists webhooks of the requester. Signing secrets are only revealed upon creation
+func (s *pinServer) HandleTaskListWebhooks() httprouter.Handle {
+	clog := logging.WithFuncName()
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		clog := clog.WithContext(r.Context())
+		u := s.currentUser(r)
+		if u.Anonymous() {
+			http.Error(w, "login required", http.StatusUnauthorized)
+			return
+		}
+		ulog := clog.WithField("userID", u.ID)
+		hooks, err := s.HS.Webhooks(r.Context(), u.ID)
+		if err != nil {
+			ulog.WithError(err).Error("error loading webhooks")
+			http.Error(w, err.Error(), err.StatusCode())
+			return
+		}
+		for _, h := range hooks {
+			h.Secret = ""
+		}
+		writeJSON(w, http.StatusOK, hooks, ulog)
+	}
+}
+
+// HandleTaskCreateWebhook registers a webhook for the requester. The response carries the secret to verify
+// signatures of callback payloads with
+func (s *pinServer) HandleTaskCreateWebhook() httprouter.Handle {
+	clog := logging.WithFuncName()
+	type Input struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+	}
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		clog := clog.WithContext(r.Context())
+		u := s.currentUser(r)
+		if u.Anonymous() {
+			http.Error(w, "login required", http.StatusUnauthorized)
+			return
+		}
+		ulog := clog.WithField("userID", u.ID)
+		in := &Input{}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(in); err != nil {
+			http.Error(w, "error parsing webhook settings", http.StatusBadRequest)
+			return
+		}
+		h, err := webhook.NewWebhook(u.ID, in.URL, in.Events)
+		if err != nil {
+			ulog.WithError(err).Error("error creating webhook")
+			http.Error(w, err.Error(), err.StatusCode())
+			return
+		}
+		if err := s.HS.SaveWebhook(r.Context(), h); err != nil {
+			ulog.WithError(err).Error("error saving webhook")
+			http.Error(w, err.Error(), err.StatusCode())
+			return
+		}
+		ulog.WithField("hookID", h.ID).Info("webhook created")
+		writeJSON(w, http.StatusCreated, h, ulog)
+	}
+}
+
+func (s *pinServer) HandleTaskDeleteWebhook() httprouter.Handle {
+	clog := logging.WithFuncName()
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		clog := clog.WithContext(r.Context())
+		u := s.currentUser(r)
+		if u.Anonymous() {
+			http.Error(w, "login required", http.StatusUnauthorized)
+			return
+		}
+		hookID := ps.ByName("hookID")
+		hlog := clog.WithField("userID", u.ID).WithField("hookID", hookID)
+		if err := s.HS.DeleteWebhook(r.Context(), u.ID, hookID); err != nil {
+			hlog.WithError(err).Error("error deleting webhook")
+			http.Error(w, err.Error(), err.StatusCode())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// HandleTaskListWebhookDeliveries lists the latest deliveries of a webhook owned by the requester
+func (s *pinServer) HandleTaskListWebhookDeliveries() httprouter.Handle {
+	clog := logging.WithFuncName()
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		clog := clog.WithContext(r.Context())
+		u := s.currentUser(r)
+		if u.Anonymous() {
+			http.Error(w, "login required", http.StatusUnauthorized)
+			return
+		}
+		hookID := ps.ByName("hookID")
+		hlog := clog.WithField("userID", u.ID).WithField("hookID", hookID)
+		hooks, err := s.HS.Webhooks(r.Context(), u.ID)
+		if err != nil {
+			hlog.WithError(err).Error("error loading webhooks")
+			http.Error(w, err.Error(), err.StatusCode())
+			return
+		}
+		var hook *md.Webhook
+		for _, h := range hooks {
+			if h.ID == hookID {
+				hook = h
+			}
+		}
+		if hook == nil {
+			http.Error(w, "webhook not found", http.StatusNotFound)
+			return
+		}
+		ds, err := s.HS.Deliveries(r.Context(), hook.ID, 0)
+		if err != nil {
+			hlog.WithError(err).Error("error loading webhook deliveries")
+			http.Error(w, err.Error(), err.StatusCode())
+			return
+		}
+		writeJSON(w, http.StatusOK, ds, hlog)
+	}
+}
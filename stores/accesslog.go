@@ -0,0 +1,74 @@
+package stores
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis"
+
+	"wuyrush.io/pin/common/logging"
+	pe "wuyrush.io/pin/errors"
+	md "wuyrush.io/pin/models"
+)
+
+// AccessLogStore vends the interface to keep track of accesses to pins.
+type AccessLogStore interface {
+	// LogAccess appends a to the access log of the given pin. The log keeps the latest maxAccessLogSize accesses
+	// only, and expires at the given expiry, which shall be the pin's expiry
+	LogAccess(ctx context.Context, pinID string, a *md.Access, expiry time.Time) *pe.PinErr
+	// AccessLog returns the access log of the given pin, latest first
+	AccessLog(ctx context.Context, pinID string) ([]*md.Access, *pe.PinErr)
+}
+
+const (
+	maxAccessLogSize = 200
+	// template to form an unique identifier for access log of a pin
+	keyTmplAccessLog = `access.%s`
+)
+
+func (s *RedisStore) LogAccess(ctx context.Context, pinID string, a *md.Access, expiry time.Time) *pe.PinErr {
+	const errMsg = "error logging pin access"
+	clog := logging.WithFuncName().WithContext(ctx).WithField("pinID", pinID)
+	b, err := json.Marshal(a)
+	if err != nil {
+		clog.WithError(err).Error("error marshalling pin access to JSON")
+		return pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	key := s.accessLogKey(pinID)
+	if _, err := s.DB.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.LPush(key, b)
+		pipe.LTrim(key, 0, maxAccessLogSize-1)
+		pipe.ExpireAt(key, expiry)
+		return nil
+	}); err != nil {
+		clog.WithError(err).Error("error calling Redis to log pin access")
+		return pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	return nil
+}
+
+func (s *RedisStore) AccessLog(ctx context.Context, pinID string) ([]*md.Access, *pe.PinErr) {
+	const errMsg = "error loading pin access log"
+	clog := logging.WithFuncName().WithContext(ctx).WithField("pinID", pinID)
+	vals, err := s.DB.LRange(s.accessLogKey(pinID), 0, -1).Result()
+	if err != nil {
+		clog.WithError(err).Error("error calling Redis to load pin access log")
+		return nil, pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	as := make([]*md.Access, 0, len(vals))
+	for _, v := range vals {
+		a := &md.Access{}
+		if err := json.Unmarshal([]byte(v), a); err != nil {
+			clog.WithError(err).Error("error unmarshalling pin access")
+			return nil, pe.ErrServiceFailure(errMsg).WithCause(err)
+		}
+		as = append(as, a)
+	}
+	return as, nil
+}
+
+func (s *RedisStore) accessLogKey(pinID string) string {
+	return fmt.Sprintf(keyTmplAccessLog, pinID)
+}
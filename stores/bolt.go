@@ -0,0 +1,683 @@
+package stores
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"wuyrush.io/pin/common/logging"
+	pe "wuyrush.io/pin/errors"
+	md "wuyrush.io/pin/models"
+)
+
+// BoltStore keeps data in a bbolt file under a local data directory, serving as PinStore, WebhookStore,
+// Throttler, AccessLogStore and TokenStore much like RedisStore does. Data survives restarts, yet the file is
+// locked by a single process, hence deleter must run embedded in the server process. Expired data is purged
+// lazily and upon deregistration. Throttle state is ephemeral by nature and is kept in memory.
+type BoltStore struct {
+	DB       *bolt.DB
+	throttle *MemoryStore
+}
+
+// file name of the database under the data directory
+const boltFileName = "pin.db"
+
+// names of bbolt buckets
+var (
+	bucketPins       = []byte("pins")       // pin ID -> boltPin
+	bucketRegs       = []byte("regs")       // pin ID -> boltReg
+	bucketIndex      = []byte("index")      // pin expiry index, see indexKey
+	bucketQuarantine = []byte("quarantine") // pin ID -> quarantine time
+	bucketFailures   = []byte("failures")   // pin ID -> md.JunkFailure
+	bucketLeases     = []byte("leases")     // pin ID -> boltLease
+	bucketAccessLogs = []byte("accessLogs") // pin ID -> boltAccessLog
+	bucketWebhooks   = []byte("webhooks")   // owner ID \x00 hook ID -> md.Webhook
+	bucketDeliveries = []byte("deliveries") // hook ID -> delivery log, latest first
+	bucketTokens     = []byte("tokens")     // token hash -> md.User
+)
+
+type boltPin struct {
+	Pin    md.Pin    `json:"pin"`
+	Expiry time.Time `json:"expiry"`
+}
+
+// boltReg is the bookkeeping data of a registered pin. Score is the pin's score in pin expiry index, which
+// quarantined pins are absent from
+type boltReg struct {
+	OwnerID string    `json:"ownerId,omitempty"`
+	Refs    []string  `json:"refs"`
+	Score   time.Time `json:"score"`
+	Indexed bool      `json:"indexed"`
+}
+
+type boltLease struct {
+	Holder string    `json:"holder"`
+	Expiry time.Time `json:"expiry"`
+}
+
+type boltAccessLog struct {
+	Accesses []*md.Access `json:"accesses"` // latest first
+	Expiry   time.Time    `json:"expiry"`
+}
+
+// NewBoltStore opens the store in dir, creating both if absent. It fails instead of waiting if another process
+// holds the file
+func NewBoltStore(dir string) (*BoltStore, *pe.PinErr) {
+	const errMsg = "failed initializing bbolt"
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	db, err := bolt.Open(filepath.Join(dir, boltFileName), 0600, &bolt.Options{Timeout: time.Second})
+	if err == bolt.ErrTimeout {
+		return nil, pe.ErrServiceFailure(fmt.Sprintf("%s is held by another process, e.g. a running server",
+			filepath.Join(dir, boltFileName))).WithCause(err)
+	}
+	if err != nil {
+		return nil, pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{bucketPins, bucketRegs, bucketIndex, bucketQuarantine, bucketFailures,
+			bucketLeases, bucketAccessLogs, bucketWebhooks, bucketDeliveries, bucketTokens} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		db.Close()
+		return nil, pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	return &BoltStore{DB: db, throttle: NewMemoryStore()}, nil
+}
+
+// indexKey forms the key of pin in pin expiry index, which sorts by score then pin ID
+func indexKey(score time.Time, pinID string) []byte {
+	k := make([]byte, 8, 8+len(pinID))
+	binary.BigEndian.PutUint64(k, uint64(score.UnixNano()))
+	return append(k, pinID...)
+}
+
+// parseIndexKey is the inverse of indexKey
+func parseIndexKey(k []byte) (time.Time, string) {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(k[:8]))), string(k[8:])
+}
+
+func getJSON(b *bolt.Bucket, key []byte, v interface{}) (bool, error) {
+	data := b.Get(key)
+	if data == nil {
+		return false, nil
+	}
+	return true, json.Unmarshal(data, v)
+}
+
+func putJSON(b *bolt.Bucket, key []byte, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, data)
+}
+
+// view runs fn in a read-only transaction. Errors of fn other than *pe.PinErr are logged and wrapped with errMsg
+func (s *BoltStore) view(ctx context.Context, errMsg string, fn func(tx *bolt.Tx) error) *pe.PinErr {
+	return s.wrap(ctx, errMsg, s.DB.View(fn))
+}
+
+// update runs fn in a read-write transaction, which is rolled back if fn fails. Errors of fn other than
+// *pe.PinErr are logged and wrapped with errMsg
+func (s *BoltStore) update(ctx context.Context, errMsg string, fn func(tx *bolt.Tx) error) *pe.PinErr {
+	return s.wrap(ctx, errMsg, s.DB.Update(fn))
+}
+
+func (s *BoltStore) wrap(ctx context.Context, errMsg string, err error) *pe.PinErr {
+	if err == nil {
+		return nil
+	}
+	if perr, ok := err.(*pe.PinErr); ok {
+		return perr
+	}
+	logging.WithFuncName().WithContext(ctx).WithError(err).Error(errMsg)
+	return pe.ErrServiceFailure(errMsg).WithCause(err)
+}
+
+// pin reads the unexpired pin data of the given ID, or returns an error of code ErrCodeNotFound
+func (s *BoltStore) pin(tx *bolt.Tx, pinID string, now time.Time) (*boltPin, error) {
+	var bp boltPin
+	ok, err := getJSON(tx.Bucket(bucketPins), []byte(pinID), &bp)
+	if err != nil {
+		return nil, err
+	}
+	if !ok || !now.Before(bp.Expiry) {
+		return nil, pe.ErrNotFound(fmt.Sprintf("pin %s not found", pinID))
+	}
+	return &bp, nil
+}
+
+// rescore moves registered pin to score in pin expiry index, or drops it from the index if indexed is unset.
+// Pins not registered are left alone
+func (s *BoltStore) rescore(tx *bolt.Tx, pinID string, score time.Time, indexed bool) error {
+	regs, index := tx.Bucket(bucketRegs), tx.Bucket(bucketIndex)
+	var reg boltReg
+	ok, err := getJSON(regs, []byte(pinID), &reg)
+	if err != nil || !ok {
+		return err
+	}
+	if reg.Indexed {
+		if err := index.Delete(indexKey(reg.Score, pinID)); err != nil {
+			return err
+		}
+	}
+	if indexed {
+		if err := index.Put(indexKey(score, pinID), nil); err != nil {
+			return err
+		}
+		reg.Score = score
+	}
+	reg.Indexed = indexed
+	return putJSON(regs, []byte(pinID), &reg)
+}
+
+func (s *BoltStore) Get(ctx context.Context, pinID string) (*md.Pin, *pe.PinErr) {
+	var p *md.Pin
+	err := s.view(ctx, "error getting pin", func(tx *bolt.Tx) error {
+		bp, err := s.pin(tx, pinID, time.Now())
+		if err != nil {
+			return err
+		}
+		p = &bp.Pin
+		return nil
+	})
+	return p, err
+}
+
+func (s *BoltStore) View(ctx context.Context, pinID string) (*md.Pin, *pe.PinErr) {
+	var p *md.Pin
+	err := s.update(ctx, "error viewing pin", func(tx *bolt.Tx) error {
+		now := time.Now()
+		bp, err := s.pin(tx, pinID, now)
+		if err != nil {
+			return err
+		}
+		if bp.Pin.Burnt() {
+			return pe.ErrNotFound(fmt.Sprintf("pin %s not found", pinID))
+		}
+		bp.Pin.ViewCount++
+		p = &bp.Pin
+		if !p.ReadAndBurn {
+			return putJSON(tx.Bucket(bucketPins), []byte(pinID), bp)
+		}
+		bp.Expiry = burnExpiry(now, bp.Expiry)
+		if err := putJSON(tx.Bucket(bucketPins), []byte(pinID), bp); err != nil {
+			return err
+		}
+		var reg boltReg
+		if ok, err := getJSON(tx.Bucket(bucketRegs), []byte(pinID), &reg); err != nil || !ok || !reg.Indexed ||
+			!reg.Score.After(bp.Expiry) {
+			return err
+		}
+		return s.rescore(tx, pinID, bp.Expiry, true)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (s *BoltStore) Register(ctx context.Context, p *md.Pin) *pe.PinErr {
+	return s.update(ctx, "error registering pin", func(tx *bolt.Tx) error {
+		regs := tx.Bucket(bucketRegs)
+		if regs.Get([]byte(p.ID)) != nil {
+			logging.WithFuncName().WithContext(ctx).WithField("pinID", p.ID).Warn("pin id collision")
+			return pe.ErrConflict(fmt.Sprintf("pin %s already exists", p.ID))
+		}
+		reg := &boltReg{OwnerID: p.OwnerID, Refs: make([]string, 0, len(p.Attachments)),
+			Score: p.CreationTime.Add(p.GoodFor), Indexed: true}
+		for _, ref := range p.Attachments {
+			reg.Refs = append(reg.Refs, ref)
+		}
+		if err := tx.Bucket(bucketIndex).Put(indexKey(reg.Score, p.ID), nil); err != nil {
+			return err
+		}
+		return putJSON(regs, []byte(p.ID), reg)
+	})
+}
+
+// Deregister drops pin data as well if it has expired, which RedisStore leaves to Redis expiry
+func (s *BoltStore) Deregister(ctx context.Context, pinID string) *pe.PinErr {
+	return s.update(ctx, "error deregistering pin", func(tx *bolt.Tx) error {
+		if err := s.rescore(tx, pinID, time.Time{}, false); err != nil {
+			return err
+		}
+		key := []byte(pinID)
+		for _, b := range [][]byte{bucketRegs, bucketFailures, bucketAccessLogs, bucketLeases} {
+			if err := tx.Bucket(b).Delete(key); err != nil {
+				return err
+			}
+		}
+		if _, err := s.pin(tx, pinID, time.Now()); err != nil {
+			if _, ok := err.(*pe.PinErr); !ok {
+				return err
+			}
+			return tx.Bucket(bucketPins).Delete(key)
+		}
+		return nil
+	})
+}
+
+func (s *BoltStore) Save(ctx context.Context, p *md.Pin) *pe.PinErr {
+	return s.update(ctx, "error saving pin", func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(bucketPins), []byte(p.ID), &boltPin{Pin: *p, Expiry: p.CreationTime.Add(p.GoodFor)})
+	})
+}
+
+func (s *BoltStore) Extend(ctx context.Context, p *md.Pin, extendBy, max time.Duration) (time.Duration, *pe.PinErr) {
+	var goodFor time.Duration
+	err := s.update(ctx, "error extending pin", func(tx *bolt.Tx) error {
+		bp, err := s.pin(tx, p.ID, time.Now())
+		if err != nil {
+			return err
+		}
+		if bp.Pin.Burnt() {
+			return pe.ErrNotFound(fmt.Sprintf("pin %s not found", p.ID))
+		}
+		if goodFor = bp.Pin.GoodFor + extendBy; goodFor > max {
+			return errExtendBeyond(max)
+		}
+		expiry := p.CreationTime.Add(goodFor)
+		bp.Pin.GoodFor, bp.Expiry = goodFor, expiry
+		if err := putJSON(tx.Bucket(bucketPins), []byte(p.ID), bp); err != nil {
+			return err
+		}
+		var reg boltReg
+		if ok, err := getJSON(tx.Bucket(bucketRegs), []byte(p.ID), &reg); err != nil {
+			return err
+		} else if ok && reg.Indexed {
+			if err := s.rescore(tx, p.ID, expiry, true); err != nil {
+				return err
+			}
+		}
+		var al boltAccessLog
+		if ok, err := getJSON(tx.Bucket(bucketAccessLogs), []byte(p.ID), &al); err != nil || !ok {
+			return err
+		}
+		al.Expiry = expiry
+		return putJSON(tx.Bucket(bucketAccessLogs), []byte(p.ID), &al)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return goodFor, nil
+}
+
+func (s *BoltStore) Delete(ctx context.Context, pinID string) *pe.PinErr {
+	return s.update(ctx, "error deleting pin", func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketPins).Delete([]byte(pinID))
+	})
+}
+
+// junkIDs visits pins in pin expiry index whose score is due by now in order of their scores, till fn returns
+// false
+func junkIDs(tx *bolt.Tx, now time.Time, fn func(score time.Time, pinID string) bool) {
+	c := tx.Bucket(bucketIndex).Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		score, pinID := parseIndexKey(k)
+		if score.After(now) || !fn(score, pinID) {
+			return
+		}
+	}
+}
+
+func (s *BoltStore) Junk(ctx context.Context, max int) ([]*md.Junk, *pe.PinErr) {
+	if max < 0 {
+		return nil, pe.ErrBadInput(fmt.Sprintf("got negative max item count %d", max))
+	}
+	var jks []*md.Junk
+	err := s.view(ctx, "error loading junk pins", func(tx *bolt.Tx) error {
+		var err error
+		junkIDs(tx, time.Now(), func(score time.Time, pinID string) bool {
+			jk := &md.Junk{PinID: pinID, Expiry: score}
+			var reg boltReg
+			if _, err = getJSON(tx.Bucket(bucketRegs), []byte(pinID), &reg); err != nil {
+				return false
+			}
+			jk.OwnerID, jk.FileRefs = reg.OwnerID, reg.Refs
+			var f md.JunkFailure
+			var ok bool
+			if ok, err = getJSON(tx.Bucket(bucketFailures), []byte(pinID), &f); err != nil {
+				return false
+			} else if ok {
+				jk.Expiry, jk.Attempts = f.Expiry, f.Attempts
+			}
+			jks = append(jks, jk)
+			return max == 0 || len(jks) < max
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return jks, nil
+}
+
+func (s *BoltStore) JunkCount(ctx context.Context) (int64, *pe.PinErr) {
+	var n int64
+	err := s.view(ctx, "error counting junk pins", func(tx *bolt.Tx) error {
+		junkIDs(tx, time.Now(), func(time.Time, string) bool {
+			n++
+			return true
+		})
+		return nil
+	})
+	return n, err
+}
+
+func (s *BoltStore) Refs(ctx context.Context, pinID string) ([]string, *pe.PinErr) {
+	var refs []string
+	err := s.view(ctx, "error getting pin attachment refs", func(tx *bolt.Tx) error {
+		var reg boltReg
+		ok, err := getJSON(tx.Bucket(bucketRegs), []byte(pinID), &reg)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return pe.ErrNotFound(fmt.Sprintf("pin %s not registered", pinID))
+		}
+		refs = reg.Refs
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
+func (s *BoltStore) Claim(ctx context.Context, pinID, holder string, ttl time.Duration) (bool, *pe.PinErr) {
+	claimed := false
+	err := s.update(ctx, "error claiming junk pin", func(tx *bolt.Tx) error {
+		now, leases := time.Now(), tx.Bucket(bucketLeases)
+		var l boltLease
+		if ok, err := getJSON(leases, []byte(pinID), &l); err != nil || ok && now.Before(l.Expiry) {
+			return err
+		}
+		claimed = true
+		return putJSON(leases, []byte(pinID), &boltLease{Holder: holder, Expiry: now.Add(ttl)})
+	})
+	return claimed, err
+}
+
+func (s *BoltStore) Renew(ctx context.Context, pinID, holder string, ttl time.Duration) (bool, *pe.PinErr) {
+	renewed := false
+	err := s.update(ctx, "error renewing lease on junk pin", func(tx *bolt.Tx) error {
+		now, leases := time.Now(), tx.Bucket(bucketLeases)
+		var l boltLease
+		if ok, err := getJSON(leases, []byte(pinID), &l); err != nil || !ok || l.Holder != holder ||
+			!now.Before(l.Expiry) {
+			return err
+		}
+		renewed = true
+		return putJSON(leases, []byte(pinID), &boltLease{Holder: holder, Expiry: now.Add(ttl)})
+	})
+	return renewed, err
+}
+
+func (s *BoltStore) Release(ctx context.Context, pinID, holder string) *pe.PinErr {
+	return s.update(ctx, "error releasing junk pin", func(tx *bolt.Tx) error {
+		leases := tx.Bucket(bucketLeases)
+		var l boltLease
+		if ok, err := getJSON(leases, []byte(pinID), &l); err != nil || !ok || l.Holder != holder {
+			return err
+		}
+		return leases.Delete([]byte(pinID))
+	})
+}
+
+func (s *BoltStore) Fail(ctx context.Context, f *md.JunkFailure, retryAt time.Time, quarantine bool) *pe.PinErr {
+	return s.update(ctx, "error recording junk pin deletion failure", func(tx *bolt.Tx) error {
+		if err := putJSON(tx.Bucket(bucketFailures), []byte(f.PinID), f); err != nil {
+			return err
+		}
+		if quarantine {
+			if err := s.rescore(tx, f.PinID, time.Time{}, false); err != nil {
+				return err
+			}
+			return putJSON(tx.Bucket(bucketQuarantine), []byte(f.PinID), f.LastAttempt)
+		}
+		var reg boltReg
+		if ok, err := getJSON(tx.Bucket(bucketRegs), []byte(f.PinID), &reg); err != nil || !ok || !reg.Indexed {
+			return err
+		}
+		return s.rescore(tx, f.PinID, retryAt, true)
+	})
+}
+
+func (s *BoltStore) Quarantined(ctx context.Context) ([]*md.JunkFailure, *pe.PinErr) {
+	var fs []*md.JunkFailure
+	qtimes := map[string]time.Time{}
+	err := s.view(ctx, "error listing quarantined junk pins", func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketQuarantine).ForEach(func(k, v []byte) error {
+			var qt time.Time
+			if err := json.Unmarshal(v, &qt); err != nil {
+				return err
+			}
+			f := &md.JunkFailure{PinID: string(k)}
+			if _, err := getJSON(tx.Bucket(bucketFailures), k, f); err != nil {
+				return err
+			}
+			qtimes[f.PinID] = qt
+			fs = append(fs, f)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(fs, func(i, j int) bool {
+		return qtimes[fs[i].PinID].Before(qtimes[fs[j].PinID])
+	})
+	return fs, nil
+}
+
+func (s *BoltStore) Requeue(ctx context.Context, pinID string) *pe.PinErr {
+	return s.update(ctx, "error requeuing junk pin", func(tx *bolt.Tx) error {
+		q := tx.Bucket(bucketQuarantine)
+		if q.Get([]byte(pinID)) == nil {
+			return pe.ErrNotFound(fmt.Sprintf("junk pin %s is not quarantined", pinID))
+		}
+		if err := q.Delete([]byte(pinID)); err != nil {
+			return err
+		}
+		if err := tx.Bucket(bucketFailures).Delete([]byte(pinID)); err != nil {
+			return err
+		}
+		return s.rescore(tx, pinID, time.Now(), true)
+	})
+}
+
+func (s *BoltStore) Discard(ctx context.Context, pinID string) *pe.PinErr {
+	err := s.update(ctx, "error discarding junk pin", func(tx *bolt.Tx) error {
+		q := tx.Bucket(bucketQuarantine)
+		if q.Get([]byte(pinID)) == nil {
+			return pe.ErrNotFound(fmt.Sprintf("junk pin %s is not quarantined", pinID))
+		}
+		return q.Delete([]byte(pinID))
+	})
+	if err != nil {
+		return err
+	}
+	return s.Deregister(ctx, pinID)
+}
+
+func (s *BoltStore) Ping(ctx context.Context) *pe.PinErr {
+	// transactions fail once the database is closed
+	return s.view(ctx, "error pinging bbolt", func(tx *bolt.Tx) error {
+		return nil
+	})
+}
+
+func (s *BoltStore) Close() *pe.PinErr {
+	if err := s.DB.Close(); err != nil {
+		return pe.ErrServiceFailure("error closing bbolt").WithCause(err)
+	}
+	return nil
+}
+
+// webhookKey forms the key of webhook, which groups webhooks by owner
+func webhookKey(ownerID, hookID string) []byte {
+	return []byte(ownerID + "\x00" + hookID)
+}
+
+func (s *BoltStore) SaveWebhook(ctx context.Context, h *md.Webhook) *pe.PinErr {
+	return s.update(ctx, "error saving webhook", func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(bucketWebhooks), webhookKey(h.OwnerID, h.ID), h)
+	})
+}
+
+func (s *BoltStore) Webhooks(ctx context.Context, ownerID string) ([]*md.Webhook, *pe.PinErr) {
+	hooks := []*md.Webhook{}
+	err := s.view(ctx, "error listing webhooks", func(tx *bolt.Tx) error {
+		prefix := webhookKey(ownerID, "")
+		c := tx.Bucket(bucketWebhooks).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var h md.Webhook
+			if err := json.Unmarshal(v, &h); err != nil {
+				return err
+			}
+			hooks = append(hooks, &h)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hooks, nil
+}
+
+func (s *BoltStore) DeleteWebhook(ctx context.Context, ownerID, hookID string) *pe.PinErr {
+	return s.update(ctx, "error deleting webhook", func(tx *bolt.Tx) error {
+		if err := tx.Bucket(bucketWebhooks).Delete(webhookKey(ownerID, hookID)); err != nil {
+			return err
+		}
+		return tx.Bucket(bucketDeliveries).Delete([]byte(hookID))
+	})
+}
+
+func (s *BoltStore) LogDelivery(ctx context.Context, d *md.Delivery) *pe.PinErr {
+	return s.update(ctx, "error logging webhook delivery", func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketDeliveries)
+		var ds []*md.Delivery
+		if _, err := getJSON(b, []byte(d.HookID), &ds); err != nil {
+			return err
+		}
+		ds = append([]*md.Delivery{d}, ds...)
+		if len(ds) > maxDeliveryLogSize {
+			ds = ds[:maxDeliveryLogSize]
+		}
+		return putJSON(b, []byte(d.HookID), ds)
+	})
+}
+
+func (s *BoltStore) Deliveries(ctx context.Context, hookID string, max int) ([]*md.Delivery, *pe.PinErr) {
+	if max < 0 {
+		return nil, pe.ErrBadInput(fmt.Sprintf("got negative max item count %d", max))
+	}
+	ds := []*md.Delivery{}
+	err := s.view(ctx, "error listing webhook deliveries", func(tx *bolt.Tx) error {
+		_, err := getJSON(tx.Bucket(bucketDeliveries), []byte(hookID), &ds)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if max > 0 && len(ds) > max {
+		ds = ds[:max]
+	}
+	return ds, nil
+}
+
+// throttle state is lost upon restarts, which merely relaxes throttling for a while
+
+func (s *BoltStore) Acquire(ctx context.Context, key string, period time.Duration) (bool, *pe.PinErr) {
+	return s.throttle.Acquire(ctx, key, period)
+}
+
+func (s *BoltStore) Allow(ctx context.Context, key string, limit int, window time.Duration) (bool, time.Duration, *pe.PinErr) {
+	return s.throttle.Allow(ctx, key, limit, window)
+}
+
+func (s *BoltStore) Count(ctx context.Context, key string, delta int64, window time.Duration) (int64, *pe.PinErr) {
+	return s.throttle.Count(ctx, key, delta, window)
+}
+
+func (s *BoltStore) LogAccess(ctx context.Context, pinID string, a *md.Access, expiry time.Time) *pe.PinErr {
+	return s.update(ctx, "error logging pin access", func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketAccessLogs)
+		var al boltAccessLog
+		if ok, err := getJSON(b, []byte(pinID), &al); err != nil {
+			return err
+		} else if !ok || !time.Now().Before(al.Expiry) {
+			al = boltAccessLog{}
+		}
+		al.Accesses = append([]*md.Access{a}, al.Accesses...)
+		if len(al.Accesses) > maxAccessLogSize {
+			al.Accesses = al.Accesses[:maxAccessLogSize]
+		}
+		al.Expiry = expiry
+		return putJSON(b, []byte(pinID), &al)
+	})
+}
+
+func (s *BoltStore) AccessLog(ctx context.Context, pinID string) ([]*md.Access, *pe.PinErr) {
+	as := []*md.Access{}
+	err := s.view(ctx, "error getting pin access log", func(tx *bolt.Tx) error {
+		var al boltAccessLog
+		if ok, err := getJSON(tx.Bucket(bucketAccessLogs), []byte(pinID), &al); err != nil || !ok {
+			return err
+		}
+		if time.Now().Before(al.Expiry) {
+			as = al.Accesses
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return as, nil
+}
+
+func (s *BoltStore) SaveToken(ctx context.Context, token string, u *md.User) *pe.PinErr {
+	return s.update(ctx, "error saving API token", func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(bucketTokens), []byte(hashToken(token)), u)
+	})
+}
+
+func (s *BoltStore) UserByToken(ctx context.Context, token string) (*md.User, *pe.PinErr) {
+	var u md.User
+	err := s.view(ctx, "error looking up API token", func(tx *bolt.Tx) error {
+		ok, err := getJSON(tx.Bucket(bucketTokens), []byte(hashToken(token)), &u)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return pe.ErrNotFound("unknown API token")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (s *BoltStore) RevokeToken(ctx context.Context, token string) *pe.PinErr {
+	return s.update(ctx, "error revoking API token", func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketTokens).Delete([]byte(hashToken(token)))
+	})
+}
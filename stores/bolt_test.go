@@ -0,0 +1,80 @@
+package stores
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	pe "wuyrush.io/pin/errors"
+	md "wuyrush.io/pin/models"
+)
+
+func TestBoltStoreContract(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pin-bolt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	n := 0
+	testPinStoreContract(t, func() PinStore {
+		n++
+		s, err := NewBoltStore(filepath.Join(dir, strconv.Itoa(n)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	})
+}
+
+func TestBoltStoreSurvivesRestart(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "pin-bolt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, perr := NewBoltStore(dir)
+	if perr != nil {
+		t.Fatal(perr)
+	}
+	now := time.Now()
+	live := &md.Pin{ID: "live", OwnerID: "alice", CreationTime: now, GoodFor: time.Hour,
+		Attachments: map[string]string{"a.txt": "live/a.txt"}}
+	stale := &md.Pin{ID: "stale", CreationTime: now.Add(-2 * time.Hour), GoodFor: time.Hour}
+	staler := &md.Pin{ID: "staler", CreationTime: now.Add(-3 * time.Hour), GoodFor: time.Hour}
+	for _, p := range []*md.Pin{live, stale, staler} {
+		if err := s.Register(ctx, p); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Save(ctx, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := NewBoltStore(dir); err == nil {
+		t.Error("expected opening store held by another process to fail")
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if s, perr = NewBoltStore(dir); perr != nil {
+		t.Fatal(perr)
+	}
+	defer s.Close()
+	if err := s.Register(ctx, live); err == nil || err.Code != pe.ErrCodeConflict {
+		t.Errorf("expected conflict registering pin twice, got %v", err)
+	}
+	if p, err := s.Get(ctx, live.ID); err != nil || p.OwnerID != "alice" || p.Attachments["a.txt"] != "live/a.txt" {
+		t.Errorf("expected live pin with its attachment, got %+v, %v", p, err)
+	}
+	jks, perr := s.Junk(ctx, 0)
+	if perr != nil {
+		t.Fatal(perr)
+	}
+	if len(jks) != 2 || jks[0].PinID != staler.ID || jks[1].PinID != stale.ID {
+		t.Errorf("expected stale pins as junk in order of expiry, got %+v", jks)
+	}
+}
@@ -0,0 +1,113 @@
+package stores
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis"
+
+	"wuyrush.io/pin/common/logging"
+	"wuyrush.io/pin/common/pinid"
+	pe "wuyrush.io/pin/errors"
+)
+
+// number of keys to examine per SCAN round trip when checking pin expiry
+const ttlScanCount = 1000
+
+// CheckTTL scans Redis for pin data without expiry, which Redis never removes. Such pins were left behind by
+// writes which set pin data and its expiry separately. If repair is set, CheckTTL expires each of them at its
+// expiry in pin expiry index, or the expiry derived from pin data if the pin is not registered. It returns IDs
+// of the pins found
+func (s *RedisStore) CheckTTL(ctx context.Context, repair bool) ([]string, *pe.PinErr) {
+	const errMsg = "error checking pin expiry"
+	clog := logging.WithFuncName().WithContext(ctx)
+	var found []string
+	var cursor uint64
+	for {
+		keys, next, err := s.DB.Scan(cursor, "", ttlScanCount).Result()
+		if err != nil {
+			clog.WithError(err).Error("error calling Redis to scan keys")
+			return found, pe.ErrServiceFailure(errMsg).WithCause(err)
+		}
+		ids, perr := s.noTTL(ctx, keys)
+		if perr != nil {
+			return found, perr
+		}
+		for _, id := range ids {
+			clog.WithField("pinID", id).Warn("found pin without expiry")
+			if repair {
+				if perr := s.repairTTL(ctx, id); perr != nil {
+					return found, perr
+				}
+			}
+		}
+		found = append(found, ids...)
+		if cursor = next; cursor == 0 {
+			return found, nil
+		}
+	}
+}
+
+// noTTL returns IDs of pins among keys whose data has no expiry
+func (s *RedisStore) noTTL(ctx context.Context, keys []string) ([]string, *pe.PinErr) {
+	// pin data is keyed by pin ID
+	var ids []string
+	for _, k := range keys {
+		if pinid.Valid(k) {
+			ids = append(ids, k)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	types, ttls := make([]*redis.StatusCmd, len(ids)), make([]*redis.DurationCmd, len(ids))
+	if _, err := s.DB.Pipelined(func(pipe redis.Pipeliner) error {
+		for i, id := range ids {
+			types[i], ttls[i] = pipe.Type(id), pipe.TTL(id)
+		}
+		return nil
+	}); err != nil {
+		logging.WithFuncName().WithContext(ctx).WithError(err).Error("error calling Redis to get pin expiry")
+		return nil, pe.ErrServiceFailure("error checking pin expiry").WithCause(err)
+	}
+	var res []string
+	for i, id := range ids {
+		// TTL replies -1 for keys without expiry, and -2 for keys gone since scanned
+		if types[i].Val() == "hash" && ttls[i].Val() == -time.Second {
+			res = append(res, id)
+		}
+	}
+	return res, nil
+}
+
+// repairTTL expires pin data without expiry
+func (s *RedisStore) repairTTL(ctx context.Context, pinID string) *pe.PinErr {
+	const errMsg = "error repairing pin expiry"
+	clog := logging.WithFuncName().WithContext(ctx).WithField("pinID", pinID)
+	var expiry time.Time
+	score, err := s.DB.ZScore(keyPinExpirySet, pinID).Result()
+	switch {
+	case err == nil:
+		expiry = time.Unix(int64(score), 0)
+	case err == redis.Nil:
+		p, perr := s.Get(ctx, pinID)
+		// pin had gone since scanned
+		if perr != nil && perr.Code == pe.ErrCodeNotFound {
+			return nil
+		}
+		if perr != nil {
+			return perr
+		}
+		expiry = p.CreationTime.Add(p.GoodFor)
+	default:
+		clog.WithError(err).Error("error calling Redis to get pin expiry from index")
+		return pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	// Redis removes pin data at once if its expiry had passed
+	if _, err := s.DB.PExpireAt(pinID, expiry).Result(); err != nil {
+		clog.WithError(err).Error("error calling Redis to expire pin")
+		return pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	clog.WithField("expiry", expiry).Info("repaired pin expiry")
+	return nil
+}
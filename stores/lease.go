@@ -0,0 +1,70 @@
+package stores
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis"
+	log "github.com/sirupsen/logrus"
+
+	"wuyrush.io/pin/common/logging"
+	pe "wuyrush.io/pin/errors"
+)
+
+// template to form an unique identifier for the lease on a junk pin
+const keyTmplLease = `lease.%s`
+
+func (s *RedisStore) Claim(ctx context.Context, pinID, holder string, ttl time.Duration) (bool, *pe.PinErr) {
+	ok, err := s.DB.SetNX(s.leaseKey(pinID), holder, ttl).Result()
+	if err != nil {
+		logging.WithFuncName().WithContext(ctx).WithError(err).WithFields(log.Fields{"pinID": pinID, "holder": holder}).
+			Error("error calling Redis to claim junk pin")
+		return false, pe.ErrServiceFailure("error claiming junk pin").WithCause(err)
+	}
+	return ok, nil
+}
+
+// scriptRenew extends a lease only if it is still held by the given holder.
+// KEYS: lease key
+// ARGV: lease holder, ttl in milliseconds
+var scriptRenew = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+func (s *RedisStore) Renew(ctx context.Context, pinID, holder string, ttl time.Duration) (bool, *pe.PinErr) {
+	n, err := scriptRenew.Run(s.DB, []string{s.leaseKey(pinID)}, holder, ttl.Milliseconds()).Int()
+	if err != nil {
+		logging.WithFuncName().WithContext(ctx).WithError(err).WithFields(log.Fields{"pinID": pinID, "holder": holder}).
+			Error("error calling Redis to renew lease on junk pin")
+		return false, pe.ErrServiceFailure("error renewing lease on junk pin").WithCause(err)
+	}
+	return n == 1, nil
+}
+
+// scriptRelease deletes a lease only if it is still held by the given holder, so that a holder whose lease had
+// run out never releases the lease of another.
+// KEYS: lease key
+// ARGV: lease holder
+var scriptRelease = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+func (s *RedisStore) Release(ctx context.Context, pinID, holder string) *pe.PinErr {
+	if _, err := scriptRelease.Run(s.DB, []string{s.leaseKey(pinID)}, holder).Result(); err != nil {
+		logging.WithFuncName().WithContext(ctx).WithError(err).WithFields(log.Fields{"pinID": pinID, "holder": holder}).
+			Error("error calling Redis to release junk pin")
+		return pe.ErrServiceFailure("error releasing junk pin").WithCause(err)
+	}
+	return nil
+}
+
+func (s *RedisStore) leaseKey(pinID string) string {
+	return fmt.Sprintf(keyTmplLease, pinID)
+}
@@ -0,0 +1,699 @@
+package stores
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+
+	cst "wuyrush.io/pin/constants"
+	pe "wuyrush.io/pin/errors"
+	md "wuyrush.io/pin/models"
+)
+
+// MemoryStore keeps data in process memory, serving as PinStore, WebhookStore, Throttler, AccessLogStore and
+// TokenStore much like RedisStore does. It is meant for development and tests: data is gone along with the
+// process, and is invisible to other processes, e.g. deleter. Expired data is purged lazily.
+type MemoryStore struct {
+	mu sync.Mutex
+	// pin data along with its expiry
+	pins map[string]*memPin
+	// bookkeeping data of registered pins, see Register
+	regs map[string]*memReg
+	// pin expiry index, whose entries are removed upon quarantine
+	index map[string]time.Time
+	// quarantined junk pins along with their quarantine time
+	quarantine map[string]time.Time
+	failures   map[string]*md.JunkFailure
+	leases     map[string]*memLease
+	accessLogs map[string]*memAccessLog
+	// throttle keys and counters along with their expiry, and hits of sliding windows
+	throttleKeys map[string]time.Time
+	counters     map[string]*memCounter
+	hits         map[string]*memHits
+	// webhooks by owner ID and hook ID, and delivery logs by hook ID, latest first
+	webhooks   map[string]map[string]*md.Webhook
+	deliveries map[string][]*md.Delivery
+	tokens     map[string]*md.User
+	lastPurge  time.Time
+}
+
+type memPin struct {
+	p      md.Pin
+	expiry time.Time
+}
+
+type memReg struct {
+	ownerID string
+	refs    []string
+}
+
+type memLease struct {
+	holder string
+	expiry time.Time
+}
+
+type memAccessLog struct {
+	as     []*md.Access // latest first
+	expiry time.Time
+}
+
+// memHits is the sliding window log of a throttle key
+type memHits struct {
+	ts     []time.Time // in order of time
+	window time.Duration
+}
+
+type memCounter struct {
+	n      int64
+	expiry time.Time
+}
+
+// expired data is purged once per this period at most
+const memPurgePeriod = time.Minute
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		pins:         map[string]*memPin{},
+		regs:         map[string]*memReg{},
+		index:        map[string]time.Time{},
+		quarantine:   map[string]time.Time{},
+		failures:     map[string]*md.JunkFailure{},
+		leases:       map[string]*memLease{},
+		accessLogs:   map[string]*memAccessLog{},
+		throttleKeys: map[string]time.Time{},
+		counters:     map[string]*memCounter{},
+		hits:         map[string]*memHits{},
+		webhooks:     map[string]map[string]*md.Webhook{},
+		deliveries:   map[string][]*md.Delivery{},
+		tokens:       map[string]*md.User{},
+		lastPurge:    time.Now(),
+	}
+}
+
+// copyPin returns a deep copy of p so that callers never share data with the store
+func copyPin(p *md.Pin) md.Pin {
+	c := *p
+	c.Attachments = make(map[string]string, len(p.Attachments))
+	for fn, ref := range p.Attachments {
+		c.Attachments[fn] = ref
+	}
+	return c
+}
+
+// pin returns the unexpired pin data of the given ID, or nil if there is none. Caller must hold s.mu
+func (s *MemoryStore) pin(pinID string, now time.Time) *memPin {
+	mp, ok := s.pins[pinID]
+	if !ok {
+		return nil
+	}
+	if !now.Before(mp.expiry) {
+		delete(s.pins, pinID)
+		return nil
+	}
+	return mp
+}
+
+// purge drops expired data, which is otherwise dropped upon access only. Caller must hold s.mu
+func (s *MemoryStore) purge(now time.Time) {
+	if now.Sub(s.lastPurge) < memPurgePeriod {
+		return
+	}
+	s.lastPurge = now
+	for id, mp := range s.pins {
+		if !now.Before(mp.expiry) {
+			delete(s.pins, id)
+		}
+	}
+	for id, l := range s.leases {
+		if !now.Before(l.expiry) {
+			delete(s.leases, id)
+		}
+	}
+	for id, al := range s.accessLogs {
+		if !now.Before(al.expiry) {
+			delete(s.accessLogs, id)
+		}
+	}
+	for k, exp := range s.throttleKeys {
+		if !now.Before(exp) {
+			delete(s.throttleKeys, k)
+		}
+	}
+	for k, c := range s.counters {
+		if !now.Before(c.expiry) {
+			delete(s.counters, k)
+		}
+	}
+	for k, hs := range s.hits {
+		// the log expires along with its latest hit
+		if len(hs.ts) == 0 || now.Sub(hs.ts[len(hs.ts)-1]) >= hs.window {
+			delete(s.hits, k)
+		}
+	}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, pinID string) (*md.Pin, *pe.PinErr) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mp := s.pin(pinID, time.Now())
+	if mp == nil {
+		return nil, pe.ErrNotFound(fmt.Sprintf("pin %s not found", pinID))
+	}
+	p := copyPin(&mp.p)
+	return &p, nil
+}
+
+func (s *MemoryStore) View(ctx context.Context, pinID string) (*md.Pin, *pe.PinErr) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	mp := s.pin(pinID, now)
+	if mp == nil || mp.p.Burnt() {
+		return nil, pe.ErrNotFound(fmt.Sprintf("pin %s not found", pinID))
+	}
+	mp.p.ViewCount++
+	p := copyPin(&mp.p)
+	if p.ReadAndBurn {
+		mp.expiry = burnExpiry(now, mp.expiry)
+		if score, ok := s.index[pinID]; ok && score.After(mp.expiry) {
+			s.index[pinID] = mp.expiry
+		}
+	}
+	return &p, nil
+}
+
+func (s *MemoryStore) Register(ctx context.Context, p *md.Pin) *pe.PinErr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.index[p.ID]; ok {
+		return pe.ErrConflict(fmt.Sprintf("pin %s already exists", p.ID))
+	}
+	if _, ok := s.regs[p.ID]; ok {
+		return pe.ErrConflict(fmt.Sprintf("pin %s already exists", p.ID))
+	}
+	refs := make([]string, 0, len(p.Attachments))
+	for _, ref := range p.Attachments {
+		refs = append(refs, ref)
+	}
+	s.index[p.ID] = p.CreationTime.Add(p.GoodFor)
+	s.regs[p.ID] = &memReg{ownerID: p.OwnerID, refs: refs}
+	return nil
+}
+
+func (s *MemoryStore) Deregister(ctx context.Context, pinID string) *pe.PinErr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.regs, pinID)
+	delete(s.failures, pinID)
+	delete(s.accessLogs, pinID)
+	delete(s.index, pinID)
+	return nil
+}
+
+func (s *MemoryStore) Save(ctx context.Context, p *md.Pin) *pe.PinErr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.purge(now)
+	s.pins[p.ID] = &memPin{p: copyPin(p), expiry: p.CreationTime.Add(p.GoodFor)}
+	return nil
+}
+
+func (s *MemoryStore) Extend(ctx context.Context, p *md.Pin, extendBy, max time.Duration) (time.Duration, *pe.PinErr) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mp := s.pin(p.ID, time.Now())
+	if mp == nil || mp.p.Burnt() {
+		return 0, pe.ErrNotFound(fmt.Sprintf("pin %s not found", p.ID))
+	}
+	goodFor := mp.p.GoodFor + extendBy
+	if goodFor > max {
+		return 0, errExtendBeyond(max)
+	}
+	expiry := p.CreationTime.Add(goodFor)
+	mp.p.GoodFor, mp.expiry = goodFor, expiry
+	if _, ok := s.index[p.ID]; ok {
+		s.index[p.ID] = expiry
+	}
+	if al, ok := s.accessLogs[p.ID]; ok {
+		al.expiry = expiry
+	}
+	return goodFor, nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, pinID string) *pe.PinErr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.pins, pinID)
+	return nil
+}
+
+func (s *MemoryStore) Junk(ctx context.Context, max int) ([]*md.Junk, *pe.PinErr) {
+	if max < 0 {
+		return nil, pe.ErrBadInput(fmt.Sprintf("got negative max item count %d", max))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.purge(now)
+	ids := s.junkIDs(now)
+	if max > 0 && len(ids) > max {
+		ids = ids[:max]
+	}
+	jks := make([]*md.Junk, 0, len(ids))
+	for _, id := range ids {
+		jk := &md.Junk{PinID: id, Expiry: s.index[id]}
+		if reg, ok := s.regs[id]; ok {
+			jk.OwnerID = reg.ownerID
+			jk.FileRefs = append([]string{}, reg.refs...)
+		}
+		if f, ok := s.failures[id]; ok {
+			jk.Expiry, jk.Attempts = f.Expiry, f.Attempts
+		}
+		jks = append(jks, jk)
+	}
+	return jks, nil
+}
+
+// junkIDs returns IDs of junk pins in order of their scores in pin expiry index. Caller must hold s.mu
+func (s *MemoryStore) junkIDs(now time.Time) []string {
+	var ids []string
+	for id, score := range s.index {
+		if !score.After(now) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		si, sj := s.index[ids[i]], s.index[ids[j]]
+		if si.Equal(sj) {
+			return ids[i] < ids[j]
+		}
+		return si.Before(sj)
+	})
+	return ids
+}
+
+func (s *MemoryStore) JunkCount(ctx context.Context) (int64, *pe.PinErr) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return int64(len(s.junkIDs(time.Now()))), nil
+}
+
+func (s *MemoryStore) Refs(ctx context.Context, pinID string) ([]string, *pe.PinErr) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reg, ok := s.regs[pinID]
+	if !ok {
+		return nil, pe.ErrNotFound(fmt.Sprintf("pin %s not registered", pinID))
+	}
+	return append([]string{}, reg.refs...), nil
+}
+
+func (s *MemoryStore) Claim(ctx context.Context, pinID, holder string, ttl time.Duration) (bool, *pe.PinErr) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if l, ok := s.leases[pinID]; ok && now.Before(l.expiry) {
+		return false, nil
+	}
+	s.leases[pinID] = &memLease{holder: holder, expiry: now.Add(ttl)}
+	return true, nil
+}
+
+func (s *MemoryStore) Renew(ctx context.Context, pinID, holder string, ttl time.Duration) (bool, *pe.PinErr) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	l, ok := s.leases[pinID]
+	if !ok || l.holder != holder || !now.Before(l.expiry) {
+		return false, nil
+	}
+	l.expiry = now.Add(ttl)
+	return true, nil
+}
+
+func (s *MemoryStore) Release(ctx context.Context, pinID, holder string) *pe.PinErr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if l, ok := s.leases[pinID]; ok && l.holder == holder {
+		delete(s.leases, pinID)
+	}
+	return nil
+}
+
+func (s *MemoryStore) Fail(ctx context.Context, f *md.JunkFailure, retryAt time.Time, quarantine bool) *pe.PinErr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := *f
+	s.failures[f.PinID] = &c
+	if quarantine {
+		delete(s.index, f.PinID)
+		s.quarantine[f.PinID] = f.LastAttempt
+		return nil
+	}
+	if _, ok := s.index[f.PinID]; ok {
+		s.index[f.PinID] = retryAt
+	}
+	return nil
+}
+
+func (s *MemoryStore) Quarantined(ctx context.Context) ([]*md.JunkFailure, *pe.PinErr) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, 0, len(s.quarantine))
+	for id := range s.quarantine {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		ti, tj := s.quarantine[ids[i]], s.quarantine[ids[j]]
+		if ti.Equal(tj) {
+			return ids[i] < ids[j]
+		}
+		return ti.Before(tj)
+	})
+	fs := make([]*md.JunkFailure, 0, len(ids))
+	for _, id := range ids {
+		f := &md.JunkFailure{PinID: id}
+		if rf, ok := s.failures[id]; ok {
+			c := *rf
+			f = &c
+		}
+		fs = append(fs, f)
+	}
+	return fs, nil
+}
+
+func (s *MemoryStore) Requeue(ctx context.Context, pinID string) *pe.PinErr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.quarantine[pinID]; !ok {
+		return pe.ErrNotFound(fmt.Sprintf("junk pin %s is not quarantined", pinID))
+	}
+	delete(s.quarantine, pinID)
+	delete(s.failures, pinID)
+	s.index[pinID] = time.Now()
+	return nil
+}
+
+func (s *MemoryStore) Discard(ctx context.Context, pinID string) *pe.PinErr {
+	s.mu.Lock()
+	if _, ok := s.quarantine[pinID]; !ok {
+		s.mu.Unlock()
+		return pe.ErrNotFound(fmt.Sprintf("junk pin %s is not quarantined", pinID))
+	}
+	delete(s.quarantine, pinID)
+	s.mu.Unlock()
+	return s.Deregister(ctx, pinID)
+}
+
+func (s *MemoryStore) Ping(ctx context.Context) *pe.PinErr {
+	return nil
+}
+
+func (s *MemoryStore) Close() *pe.PinErr {
+	return nil
+}
+
+func (s *MemoryStore) SaveWebhook(ctx context.Context, h *md.Webhook) *pe.PinErr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hooks, ok := s.webhooks[h.OwnerID]
+	if !ok {
+		hooks = map[string]*md.Webhook{}
+		s.webhooks[h.OwnerID] = hooks
+	}
+	c := *h
+	c.Events = append([]string{}, h.Events...)
+	hooks[h.ID] = &c
+	return nil
+}
+
+func (s *MemoryStore) Webhooks(ctx context.Context, ownerID string) ([]*md.Webhook, *pe.PinErr) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hooks := make([]*md.Webhook, 0, len(s.webhooks[ownerID]))
+	for _, h := range s.webhooks[ownerID] {
+		c := *h
+		c.Events = append([]string{}, h.Events...)
+		hooks = append(hooks, &c)
+	}
+	return hooks, nil
+}
+
+func (s *MemoryStore) DeleteWebhook(ctx context.Context, ownerID, hookID string) *pe.PinErr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.webhooks[ownerID], hookID)
+	delete(s.deliveries, hookID)
+	return nil
+}
+
+func (s *MemoryStore) LogDelivery(ctx context.Context, d *md.Delivery) *pe.PinErr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := *d
+	ds := append([]*md.Delivery{&c}, s.deliveries[d.HookID]...)
+	if len(ds) > maxDeliveryLogSize {
+		ds = ds[:maxDeliveryLogSize]
+	}
+	s.deliveries[d.HookID] = ds
+	return nil
+}
+
+func (s *MemoryStore) Deliveries(ctx context.Context, hookID string, max int) ([]*md.Delivery, *pe.PinErr) {
+	if max < 0 {
+		return nil, pe.ErrBadInput(fmt.Sprintf("got negative max item count %d", max))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ds := s.deliveries[hookID]
+	if max > 0 && len(ds) > max {
+		ds = ds[:max]
+	}
+	res := make([]*md.Delivery, 0, len(ds))
+	for _, d := range ds {
+		c := *d
+		res = append(res, &c)
+	}
+	return res, nil
+}
+
+func (s *MemoryStore) Acquire(ctx context.Context, key string, period time.Duration) (bool, *pe.PinErr) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if exp, ok := s.throttleKeys[key]; ok && now.Before(exp) {
+		return false, nil
+	}
+	s.throttleKeys[key] = now.Add(period)
+	return true, nil
+}
+
+func (s *MemoryStore) Allow(ctx context.Context, key string, limit int, window time.Duration) (bool, time.Duration, *pe.PinErr) {
+	if limit <= 0 || window <= 0 {
+		return false, 0, pe.ErrBadInput("rate limit and window size must be positive")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	hs, ok := s.hits[key]
+	if !ok {
+		hs = &memHits{}
+		s.hits[key] = hs
+	}
+	hs.window = window
+	// drop hits out of the window from the head
+	for len(hs.ts) > 0 && !hs.ts[0].After(now.Add(-window)) {
+		hs.ts = hs.ts[1:]
+	}
+	if len(hs.ts) < limit {
+		hs.ts = append(hs.ts, now)
+		return true, 0, nil
+	}
+	wait := hs.ts[0].Add(window).Sub(now)
+	if wait < time.Millisecond {
+		wait = time.Millisecond
+	}
+	return false, wait, nil
+}
+
+func (s *MemoryStore) Count(ctx context.Context, key string, delta int64, window time.Duration) (int64, *pe.PinErr) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	c, ok := s.counters[key]
+	if !ok || !now.Before(c.expiry) {
+		// the window starts upon the first count
+		c = &memCounter{expiry: now.Add(window)}
+		s.counters[key] = c
+	}
+	c.n += delta
+	return c.n, nil
+}
+
+func (s *MemoryStore) LogAccess(ctx context.Context, pinID string, a *md.Access, expiry time.Time) *pe.PinErr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	al, ok := s.accessLogs[pinID]
+	if !ok || !time.Now().Before(al.expiry) {
+		al = &memAccessLog{}
+		s.accessLogs[pinID] = al
+	}
+	c := *a
+	al.as = append([]*md.Access{&c}, al.as...)
+	if len(al.as) > maxAccessLogSize {
+		al.as = al.as[:maxAccessLogSize]
+	}
+	al.expiry = expiry
+	return nil
+}
+
+func (s *MemoryStore) AccessLog(ctx context.Context, pinID string) ([]*md.Access, *pe.PinErr) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	al, ok := s.accessLogs[pinID]
+	if !ok || !time.Now().Before(al.expiry) {
+		delete(s.accessLogs, pinID)
+		return []*md.Access{}, nil
+	}
+	as := make([]*md.Access, 0, len(al.as))
+	for _, a := range al.as {
+		c := *a
+		as = append(as, &c)
+	}
+	return as, nil
+}
+
+func (s *MemoryStore) SaveToken(ctx context.Context, token string, u *md.User) *pe.PinErr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := *u
+	s.tokens[hashToken(token)] = &c
+	return nil
+}
+
+func (s *MemoryStore) UserByToken(ctx context.Context, token string) (*md.User, *pe.PinErr) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.tokens[hashToken(token)]
+	if !ok {
+		return nil, pe.ErrNotFound("unknown API token")
+	}
+	c := *u
+	return &c, nil
+}
+
+func (s *MemoryStore) RevokeToken(ctx context.Context, token string) *pe.PinErr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tokens, hashToken(token))
+	return nil
+}
+
+// MemoryFileStore implements FileStore in process memory, for development and tests. References are formed
+// as <pin ID>/<filename>
+type MemoryFileStore struct {
+	mu    sync.Mutex
+	files map[string]*memFile
+}
+
+type memFile struct {
+	data    []byte
+	modTime time.Time
+}
+
+func NewMemoryFileStore() *MemoryFileStore {
+	return &MemoryFileStore{files: map[string]*memFile{}}
+}
+
+func (fs *MemoryFileStore) Ref(pinID, filename string) string {
+	return pinID + "/" + filename
+}
+
+func (fs *MemoryFileStore) Save(ctx context.Context, ref string, r io.ReadCloser) *pe.PinErr {
+	// attachment size is capped the same way as LocalFileStore does
+	data, err := ioutil.ReadAll(http.MaxBytesReader(nil, r, viper.GetInt64(cst.EnvPinAttachmentSizeMaxByte)))
+	if err != nil {
+		if strings.Index(err.Error(), cst.ErrMsgRequestBodyTooLarge) >= 0 {
+			return pe.ErrBadInput("pin attachment oversized").WithCause(err)
+		}
+		return pe.ErrServiceFailure("error saving pin attachment data").WithCause(err)
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.files[ref] = &memFile{data: data, modTime: time.Now()}
+	return nil
+}
+
+func (fs *MemoryFileStore) Get(ctx context.Context, ref string) (io.ReadCloser, *pe.PinErr) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	f, ok := fs.files[ref]
+	if !ok {
+		return nil, pe.ErrNotFound("pin attachment not found")
+	}
+	// saved data is never modified in place, hence safe to share
+	return ioutil.NopCloser(bytes.NewReader(f.data)), nil
+}
+
+func (fs *MemoryFileStore) Size(ctx context.Context, ref string) (int64, *pe.PinErr) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	f, ok := fs.files[ref]
+	if !ok {
+		return 0, pe.ErrNotFound("pin attachment not found")
+	}
+	return int64(len(f.data)), nil
+}
+
+func (fs *MemoryFileStore) Delete(ctx context.Context, ref string) *pe.PinErr {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	delete(fs.files, ref)
+	return nil
+}
+
+// Walk visits files in order of their references, hence pin by pin. fn is called without holding the lock so
+// that it is free to call other methods of fs
+func (fs *MemoryFileStore) Walk(ctx context.Context, fn func(pinID, ref string, modTime time.Time) error) *pe.PinErr {
+	const errMsg = "error walking file store"
+	fs.mu.Lock()
+	refs := make([]string, 0, len(fs.files))
+	modTimes := make(map[string]time.Time, len(fs.files))
+	for ref, f := range fs.files {
+		refs = append(refs, ref)
+		modTimes[ref] = f.modTime
+	}
+	fs.mu.Unlock()
+	sort.Strings(refs)
+	for _, ref := range refs {
+		if err := ctx.Err(); err != nil {
+			return pe.ErrServiceFailure(errMsg).WithCause(err)
+		}
+		pinID := ref
+		if i := strings.Index(ref, "/"); i >= 0 {
+			pinID = ref[:i]
+		}
+		if err := fn(pinID, ref, modTimes[ref]); err != nil {
+			return pe.ErrServiceFailure(errMsg).WithCause(err)
+		}
+	}
+	return nil
+}
+
+func (fs *MemoryFileStore) Ping(ctx context.Context) *pe.PinErr {
+	return nil
+}
+
+func (fs *MemoryFileStore) Close() *pe.PinErr {
+	return nil
+}
@@ -0,0 +1,9 @@
+package stores
+
+import (
+	"testing"
+)
+
+func TestMemoryStoreContract(t *testing.T) {
+	testPinStoreContract(t, func() PinStore { return NewMemoryStore() })
+}
@@ -0,0 +1,140 @@
+package stores
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis"
+
+	"wuyrush.io/pin/common/logging"
+	pe "wuyrush.io/pin/errors"
+	md "wuyrush.io/pin/models"
+)
+
+const (
+	// redis key of the sorted set holding quarantined junk pins, scored by quarantine time
+	keyPinQuarantineSet = "pinQuarantineSet"
+	// template to form an unique identifier for the failure record of a junk pin
+	keyTmplFailure = `failure.%s`
+)
+
+// scriptFail records a failed attempt to delete a junk pin, and either schedules the next attempt by re-scoring
+// the pin in pin expiry index, or moves the pin to quarantine.
+// KEYS: failure record key, pin expiry index key, quarantine set key
+// ARGV: failure record, "1" to quarantine the pin or "0" otherwise, score to re-score or quarantine with, pin ID
+var scriptFail = redis.NewScript(`
+redis.call("SET", KEYS[1], ARGV[1])
+if ARGV[2] == "1" then
+	redis.call("ZREM", KEYS[2], ARGV[4])
+	redis.call("ZADD", KEYS[3], ARGV[3], ARGV[4])
+else
+	redis.call("ZADD", KEYS[2], "XX", ARGV[3], ARGV[4])
+end
+return 1
+`)
+
+func (s *RedisStore) Fail(ctx context.Context, f *md.JunkFailure, retryAt time.Time, quarantine bool) *pe.PinErr {
+	const errMsg = "error recording junk pin failure"
+	clog := logging.WithFuncName().WithContext(ctx).WithField("pinID", f.PinID)
+	b, err := json.Marshal(f)
+	if err != nil {
+		clog.WithError(err).Error("error marshalling junk pin failure to JSON")
+		return pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	q, score := "0", retryAt.Unix()
+	if quarantine {
+		q, score = "1", f.LastAttempt.Unix()
+	}
+	keys := []string{s.failureKey(f.PinID), keyPinExpirySet, keyPinQuarantineSet}
+	if _, err := scriptFail.Run(s.DB, keys, b, q, score, f.PinID).Result(); err != nil {
+		clog.WithError(err).Error("error calling Redis to record junk pin failure")
+		return pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	return nil
+}
+
+func (s *RedisStore) Quarantined(ctx context.Context) ([]*md.JunkFailure, *pe.PinErr) {
+	const errMsg = "error loading quarantined junk pins"
+	clog := logging.WithFuncName().WithContext(ctx)
+	ids, err := s.DB.ZRange(keyPinQuarantineSet, 0, -1).Result()
+	if err != nil {
+		clog.WithError(err).Error("error calling Redis to load quarantined junk pins")
+		return nil, pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	fs := make([]*md.JunkFailure, 0, len(ids))
+	for _, id := range ids {
+		f, err := s.failure(id)
+		if err != nil {
+			clog.WithError(err).WithField("pinID", id).Error("error loading junk pin failure")
+			return nil, pe.ErrServiceFailure(errMsg).WithCause(err)
+		}
+		if f == nil {
+			// failure records go along with quarantined pins, yet tolerate the missing ones
+			f = &md.JunkFailure{PinID: id}
+		}
+		fs = append(fs, f)
+	}
+	return fs, nil
+}
+
+// scriptRequeue moves a quarantined pin back to pin expiry index with a fresh failure record.
+// KEYS: quarantine set key, pin expiry index key, failure record key
+// ARGV: score in pin expiry index, pin ID
+var scriptRequeue = redis.NewScript(`
+if redis.call("ZREM", KEYS[1], ARGV[2]) == 0 then
+	return 0
+end
+redis.call("ZADD", KEYS[2], ARGV[1], ARGV[2])
+redis.call("DEL", KEYS[3])
+return 1
+`)
+
+func (s *RedisStore) Requeue(ctx context.Context, pinID string) *pe.PinErr {
+	keys := []string{keyPinQuarantineSet, keyPinExpirySet, s.failureKey(pinID)}
+	n, err := scriptRequeue.Run(s.DB, keys, time.Now().Unix(), pinID).Int()
+	if err != nil {
+		logging.WithFuncName().WithContext(ctx).WithError(err).WithField("pinID", pinID).
+			Error("error calling Redis to requeue junk pin")
+		return pe.ErrServiceFailure("error requeueing junk pin").WithCause(err)
+	}
+	if n == 0 {
+		return pe.ErrNotFound(fmt.Sprintf("junk pin %s is not quarantined", pinID))
+	}
+	return nil
+}
+
+func (s *RedisStore) Discard(ctx context.Context, pinID string) *pe.PinErr {
+	n, err := s.DB.ZRem(keyPinQuarantineSet, pinID).Result()
+	if err != nil {
+		logging.WithFuncName().WithContext(ctx).WithError(err).WithField("pinID", pinID).
+			Error("error calling Redis to discard junk pin")
+		return pe.ErrServiceFailure("error discarding junk pin").WithCause(err)
+	}
+	if n == 0 {
+		return pe.ErrNotFound(fmt.Sprintf("junk pin %s is not quarantined", pinID))
+	}
+	// Deregister drops the failure record along with the rest of bookkeeping data
+	return s.Deregister(ctx, pinID)
+}
+
+// failure returns the failure record of junk pin, or nil if there is none
+func (s *RedisStore) failure(pinID string) (*md.JunkFailure, error) {
+	v, err := s.DB.Get(s.failureKey(pinID)).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	f := &md.JunkFailure{}
+	if err := json.Unmarshal([]byte(v), f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (s *RedisStore) failureKey(pinID string) string {
+	return fmt.Sprintf(keyTmplFailure, pinID)
+}
@@ -0,0 +1,1104 @@
+package stores
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/viper"
+	"wuyrush.io/pin/common/logging"
+	cst "wuyrush.io/pin/constants"
+	pe "wuyrush.io/pin/errors"
+	md "wuyrush.io/pin/models"
+)
+
+// SQLStore keeps data in a relational database through database/sql, serving as PinStore, WebhookStore,
+// Throttler, AccessLogStore and TokenStore much like RedisStore does, for deployments which need pins kept in one
+// for audit purpose. Callers open DB with a driver of their choice. The schema is migrated to the latest version
+// upon NewSQLStore. Expired data is purged lazily.
+//
+// SQLite has no row locks, hence its DSN shall begin transactions in immediate mode, e.g. _txlock=immediate
+// with github.com/mattn/go-sqlite3, so that views of the same pin are serialized.
+type SQLStore struct {
+	DB      *sql.DB
+	Dialect string
+	// lastPurge is the time expired throttle state was last purged in unix nanoseconds, accessed atomically
+	lastPurge int64
+}
+
+// SQL dialects supported by SQLStore
+const (
+	DialectSQLite   = "sqlite3"
+	DialectPostgres = "postgres"
+	DialectMySQL    = "mysql"
+)
+
+// sqlMigrations are statements to migrate the schema to each version, where the version of a migration is its
+// index plus one. Applied migrations must never change; append new ones instead. Times are unix nanoseconds
+var sqlMigrations = [][]string{
+	{
+		`CREATE TABLE pins (
+			id VARCHAR(255) PRIMARY KEY,
+			owner_id VARCHAR(255) NOT NULL,
+			mode INTEGER NOT NULL,
+			creation_time BIGINT NOT NULL,
+			good_for BIGINT NOT NULL,
+			read_and_burn BOOLEAN NOT NULL,
+			view_count BIGINT NOT NULL,
+			title TEXT NOT NULL,
+			note TEXT NOT NULL,
+			notify_on_view INTEGER NOT NULL,
+			notify_addr TEXT NOT NULL,
+			attachments TEXT NOT NULL,
+			expiry BIGINT NOT NULL
+		)`,
+		// score is the pin's score in pin expiry index, or NULL once the pin is quarantined
+		`CREATE TABLE registrations (
+			pin_id VARCHAR(255) PRIMARY KEY,
+			owner_id VARCHAR(255) NOT NULL,
+			refs TEXT NOT NULL,
+			score BIGINT
+		)`,
+		`CREATE INDEX registrations_score ON registrations (score)`,
+		`CREATE TABLE junk_failures (
+			pin_id VARCHAR(255) PRIMARY KEY,
+			attempts INTEGER NOT NULL,
+			last_err TEXT NOT NULL,
+			last_attempt BIGINT NOT NULL,
+			expiry BIGINT NOT NULL,
+			quarantine_time BIGINT
+		)`,
+		`CREATE TABLE leases (
+			pin_id VARCHAR(255) PRIMARY KEY,
+			holder VARCHAR(255) NOT NULL,
+			expiry BIGINT NOT NULL
+		)`,
+	},
+	{
+		// webhooks and deliveries are kept as JSON, since they are only ever looked up as a whole
+		`CREATE TABLE webhooks (
+			id VARCHAR(255) PRIMARY KEY,
+			owner_id VARCHAR(255) NOT NULL,
+			data TEXT NOT NULL
+		)`,
+		`CREATE INDEX webhooks_owner_id ON webhooks (owner_id)`,
+		`CREATE TABLE deliveries (
+			id VARCHAR(255) PRIMARY KEY,
+			hook_id VARCHAR(255) NOT NULL,
+			delivery_time BIGINT NOT NULL,
+			data TEXT NOT NULL
+		)`,
+		`CREATE INDEX deliveries_hook_id ON deliveries (hook_id, delivery_time)`,
+		`CREATE TABLE access_logs (
+			pin_id VARCHAR(255) NOT NULL,
+			access_time BIGINT NOT NULL,
+			data TEXT NOT NULL,
+			expiry BIGINT NOT NULL
+		)`,
+		`CREATE INDEX access_logs_pin_id ON access_logs (pin_id, access_time)`,
+		`CREATE TABLE throttle_keys (
+			name VARCHAR(255) PRIMARY KEY,
+			expiry BIGINT NOT NULL
+		)`,
+		`CREATE TABLE throttle_counters (
+			name VARCHAR(255) PRIMARY KEY,
+			hits BIGINT NOT NULL,
+			expiry BIGINT NOT NULL
+		)`,
+		`CREATE TABLE throttle_hits (
+			name VARCHAR(255) NOT NULL,
+			hit_time BIGINT NOT NULL,
+			expiry BIGINT NOT NULL
+		)`,
+		`CREATE INDEX throttle_hits_name ON throttle_hits (name, hit_time)`,
+		`CREATE INDEX throttle_hits_expiry ON throttle_hits (expiry)`,
+	},
+	{
+		`CREATE TABLE tokens (
+			hash VARCHAR(64) PRIMARY KEY,
+			data TEXT NOT NULL
+		)`,
+	},
+}
+
+// NewSQLStore returns a SQLStore on db speaking the given dialect, with the schema migrated to the latest version
+func NewSQLStore(db *sql.DB, dialect string) (*SQLStore, *pe.PinErr) {
+	switch dialect {
+	case DialectSQLite, DialectPostgres, DialectMySQL:
+	default:
+		return nil, pe.ErrBadInput(fmt.Sprintf("unknown SQL dialect %q", dialect))
+	}
+	s := &SQLStore{DB: db, Dialect: dialect, lastPurge: time.Now().UnixNano()}
+	if err := s.Migrate(context.Background()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// OpenSQLStore opens the database of the given DSN with the named driver, which must be registered by the
+// program, and returns a SQLStore on it. Driver names double as dialects
+func OpenSQLStore(driver, dsn string) (*SQLStore, *pe.PinErr) {
+	if driver == DialectSQLite && !strings.Contains(dsn, "_txlock=immediate") {
+		logging.WithFuncName().Warn("SQLite DSN does not begin transactions in immediate mode. Concurrent views of read-and-burn pins may fail")
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, pe.ErrBadInput(fmt.Sprintf("error opening %s database", driver)).WithCause(err)
+	}
+	s, perr := NewSQLStore(db, driver)
+	if perr != nil {
+		db.Close()
+		return nil, perr
+	}
+	return s, nil
+}
+
+// OpenSQLStoreFromEnv opens the SQL database configured by env vars, whose driver must be registered by the
+// program
+func OpenSQLStoreFromEnv() (*SQLStore, *pe.PinErr) {
+	driver, dsn := viper.GetString(cst.EnvSQLDriver), viper.GetString(cst.EnvSQLDSN)
+	if driver == "" || dsn == "" {
+		return nil, pe.ErrBadInput(fmt.Sprintf("%s and %s must be set to keep pin data in %s",
+			cst.EnvSQLDriver, cst.EnvSQLDSN, BackendSQL))
+	}
+	return OpenSQLStore(driver, dsn)
+}
+
+// name of the lock serializing schema migrations across processes, and its numeric form for Postgres
+const (
+	sqlMigrationLock         = "pin.schema_migrations"
+	sqlMigrationLockID int64 = 7467306574
+)
+
+// Migrate applies pending schema migrations in order, each in a transaction of its own. MySQL commits schema
+// changes implicitly, hence a migration failing halfway there must be cleaned up by hand. Processes migrating
+// the schema at the same time take turns, so that each migration applies once
+func (s *SQLStore) Migrate(ctx context.Context) *pe.PinErr {
+	const errMsg = "error migrating schema"
+	clog := logging.WithFuncName().WithContext(ctx)
+	// the lock is held by the connection taking it, which must run the migrations as well
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		clog.WithError(err).Error("error getting database connection")
+		return pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	defer conn.Close()
+	unlock, err := s.lockMigrations(ctx, conn)
+	if err != nil {
+		clog.WithError(err).Error("error locking schema migrations")
+		return pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	defer unlock()
+	if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		applied_at BIGINT NOT NULL
+	)`); err != nil {
+		clog.WithError(err).Error("error creating schema migration table")
+		return pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	for i := range sqlMigrations {
+		version, applied := i+1, false
+		err := s.txOn(ctx, conn, fmt.Sprintf("error migrating schema to version %d", version), func(tx *sql.Tx) error {
+			// SQLite has no lock to take but the transaction itself, hence the version is checked within
+			var n int
+			if err := tx.QueryRowContext(ctx, s.q(`SELECT COUNT(*) FROM schema_migrations WHERE version = ?`),
+				version).Scan(&n); err != nil || n > 0 {
+				applied = n > 0
+				return err
+			}
+			for _, stmt := range sqlMigrations[i] {
+				if _, err := tx.ExecContext(ctx, stmt); err != nil {
+					return err
+				}
+			}
+			_, err := tx.ExecContext(ctx, s.q(`INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`),
+				version, time.Now().UnixNano())
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if !applied {
+			clog.WithField("version", version).Info("migrated schema")
+		}
+	}
+	return nil
+}
+
+// lockMigrations takes the lock on schema migrations with conn, and returns the function to release the lock
+func (s *SQLStore) lockMigrations(ctx context.Context, conn *sql.Conn) (func(), error) {
+	var lock, unlock string
+	var arg interface{}
+	switch s.Dialect {
+	case DialectPostgres:
+		lock, unlock, arg = `SELECT pg_advisory_lock(?)`, `SELECT pg_advisory_unlock(?)`, sqlMigrationLockID
+	case DialectMySQL:
+		lock, unlock, arg = `SELECT GET_LOCK(?, -1)`, `SELECT RELEASE_LOCK(?)`, sqlMigrationLock
+	default:
+		return func() {}, nil
+	}
+	if _, err := conn.ExecContext(ctx, s.q(lock), arg); err != nil {
+		return nil, err
+	}
+	return func() {
+		if _, err := conn.ExecContext(context.Background(), s.q(unlock), arg); err != nil {
+			logging.WithFuncName().WithContext(ctx).WithError(err).Warn("error unlocking schema migrations")
+		}
+	}, nil
+}
+
+// q rewrites placeholders of query for the dialect of s, since Postgres numbers them
+func (s *SQLStore) q(query string) string {
+	if s.Dialect != DialectPostgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// forUpdate returns the clause locking rows selected in a transaction. SQLite locks the whole database instead
+func (s *SQLStore) forUpdate() string {
+	if s.Dialect == DialectSQLite {
+		return ""
+	}
+	return " FOR UPDATE"
+}
+
+// tx runs fn in a transaction, which is rolled back if fn fails. Errors of fn other than *pe.PinErr are logged
+// and wrapped with errMsg
+func (s *SQLStore) tx(ctx context.Context, errMsg string, fn func(tx *sql.Tx) error) *pe.PinErr {
+	return s.txOn(ctx, s.DB, errMsg, fn)
+}
+
+// txBeginner begins transactions, e.g. *sql.DB and *sql.Conn
+type txBeginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// txOn is tx running on the given connection or pool
+func (s *SQLStore) txOn(ctx context.Context, b txBeginner, errMsg string, fn func(tx *sql.Tx) error) *pe.PinErr {
+	clog := logging.WithFuncName().WithContext(ctx)
+	tx, err := b.BeginTx(ctx, nil)
+	if err != nil {
+		clog.WithError(err).Error(errMsg)
+		return pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	if err := fn(tx); err != nil {
+		if rerr := tx.Rollback(); rerr != nil {
+			clog.WithError(rerr).Warn("error rolling back transaction")
+		}
+		if perr, ok := err.(*pe.PinErr); ok {
+			return perr
+		}
+		clog.WithError(err).Error(errMsg)
+		return pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	if err := tx.Commit(); err != nil {
+		clog.WithError(err).Error(errMsg)
+		return pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	return nil
+}
+
+// exec runs a single statement. Errors are logged and wrapped with errMsg
+func (s *SQLStore) exec(ctx context.Context, errMsg, query string, args ...interface{}) *pe.PinErr {
+	if _, err := s.DB.ExecContext(ctx, s.q(query), args...); err != nil {
+		logging.WithFuncName().WithContext(ctx).WithError(err).Error(errMsg)
+		return pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	return nil
+}
+
+// isUniqueViolation tells whether err is a violation of unique constraint, as reported by drivers of SQLite,
+// Postgres and MySQL respectively. Drivers have error types of their own, hence messages are matched instead
+func isUniqueViolation(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "UNIQUE constraint failed") ||
+		strings.Contains(msg, "duplicate key value violates unique constraint") ||
+		strings.Contains(msg, "Duplicate entry")
+}
+
+// exists reports whether the row of the given pin ID satisfying cond is present in table
+func (s *SQLStore) exists(ctx context.Context, tx *sql.Tx, table, cond, pinID string) (bool, error) {
+	var n int
+	query := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE pin_id = ?%s`, table, cond)
+	if err := tx.QueryRowContext(ctx, s.q(query), pinID).Scan(&n); err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+const sqlPinColumns = `id, owner_id, mode, creation_time, good_for, read_and_burn, view_count, title, note,
+	notify_on_view, notify_addr, attachments, expiry`
+
+// pin reads the unexpired pin data of the given ID, locking its row if lock is set. It returns an error of code
+// ErrCodeNotFound if there is none
+func (s *SQLStore) pin(ctx context.Context, tx *sql.Tx, pinID string, lock bool) (*md.Pin, error) {
+	query := `SELECT ` + sqlPinColumns + ` FROM pins WHERE id = ? AND expiry > ?`
+	if lock {
+		query += s.forUpdate()
+	}
+	var (
+		p                                md.Pin
+		mode, notifyOnView               int
+		creationTime, goodFor, viewCount int64
+		expiry                           int64
+		attachments                      string
+	)
+	err := tx.QueryRowContext(ctx, s.q(query), pinID, time.Now().UnixNano()).Scan(&p.ID, &p.OwnerID, &mode,
+		&creationTime, &goodFor, &p.ReadAndBurn, &viewCount, &p.Title, &p.Note, &notifyOnView, &p.NotifyAddr,
+		&attachments, &expiry)
+	if err == sql.ErrNoRows {
+		return nil, pe.ErrNotFound(fmt.Sprintf("pin %s not found", pinID))
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.Mode, p.NotifyOnView = md.AccessMode(mode), md.ViewNotice(notifyOnView)
+	p.CreationTime, p.GoodFor = time.Unix(0, creationTime), time.Duration(goodFor)
+	p.ViewCount = uint64(viewCount)
+	if err := json.Unmarshal([]byte(attachments), &p.Attachments); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (s *SQLStore) Get(ctx context.Context, pinID string) (*md.Pin, *pe.PinErr) {
+	var p *md.Pin
+	err := s.tx(ctx, "error getting pin", func(tx *sql.Tx) error {
+		var err error
+		p, err = s.pin(ctx, tx, pinID, false)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (s *SQLStore) View(ctx context.Context, pinID string) (*md.Pin, *pe.PinErr) {
+	var p *md.Pin
+	err := s.tx(ctx, "error viewing pin", func(tx *sql.Tx) error {
+		var err error
+		// the row lock serializes views of the pin, so that a read-and-burn pin is viewed once only
+		if p, err = s.pin(ctx, tx, pinID, true); err != nil {
+			return err
+		}
+		if p.Burnt() {
+			return pe.ErrNotFound(fmt.Sprintf("pin %s not found", pinID))
+		}
+		p.ViewCount++
+		if !p.ReadAndBurn {
+			_, err = tx.ExecContext(ctx, s.q(`UPDATE pins SET view_count = ? WHERE id = ?`), int64(p.ViewCount), pinID)
+			return err
+		}
+		expiry := burnExpiry(time.Now(), p.CreationTime.Add(p.GoodFor)).UnixNano()
+		if _, err := tx.ExecContext(ctx, s.q(`UPDATE pins SET view_count = ?, expiry = ? WHERE id = ?`),
+			int64(p.ViewCount), expiry, pinID); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, s.q(`UPDATE registrations SET score = ? WHERE pin_id = ? AND score > ?`),
+			expiry, pinID, expiry)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (s *SQLStore) Register(ctx context.Context, p *md.Pin) *pe.PinErr {
+	clog := logging.WithFuncName().WithContext(ctx).WithField("pinID", p.ID)
+	refs := make([]string, 0, len(p.Attachments))
+	for _, ref := range p.Attachments {
+		refs = append(refs, ref)
+	}
+	refsByte, err := json.Marshal(refs)
+	if err != nil {
+		clog.WithError(err).Error("error marshalling pin attachment references to json")
+		return pe.ErrServiceFailure("error registering pin").WithCause(err)
+	}
+	return s.tx(ctx, "error registering pin", func(tx *sql.Tx) error {
+		if ok, err := s.exists(ctx, tx, "registrations", "", p.ID); err != nil {
+			return err
+		} else if ok {
+			clog.Warn("pin id collision")
+			return pe.ErrConflict(fmt.Sprintf("pin %s already exists", p.ID))
+		}
+		// a concurrent registration of the same ID may slip in between the check and the insert, e.g. on Postgres
+		// and MySQL in READ COMMITTED
+		_, err := tx.ExecContext(ctx, s.q(`INSERT INTO registrations (pin_id, owner_id, refs, score) VALUES (?, ?, ?, ?)`),
+			p.ID, p.OwnerID, string(refsByte), p.CreationTime.Add(p.GoodFor).UnixNano())
+		if err != nil && isUniqueViolation(err) {
+			clog.Warn("pin id collision")
+			return pe.ErrConflict(fmt.Sprintf("pin %s already exists", p.ID))
+		}
+		return err
+	})
+}
+
+// deregister removes registration of the given pin along with its bookkeeping data, as well as its data if it
+// has expired
+func (s *SQLStore) deregister(ctx context.Context, tx *sql.Tx, pinID string) error {
+	for _, table := range []string{"registrations", "junk_failures", "leases", "access_logs"} {
+		if _, err := tx.ExecContext(ctx, s.q(`DELETE FROM `+table+` WHERE pin_id = ?`), pinID); err != nil {
+			return err
+		}
+	}
+	_, err := tx.ExecContext(ctx, s.q(`DELETE FROM pins WHERE id = ? AND expiry <= ?`), pinID, time.Now().UnixNano())
+	return err
+}
+
+func (s *SQLStore) Deregister(ctx context.Context, pinID string) *pe.PinErr {
+	return s.tx(ctx, "error deregistering pin", func(tx *sql.Tx) error {
+		return s.deregister(ctx, tx, pinID)
+	})
+}
+
+func (s *SQLStore) Save(ctx context.Context, p *md.Pin) *pe.PinErr {
+	attachments, err := json.Marshal(p.Attachments)
+	if err != nil {
+		logging.WithFuncName().WithContext(ctx).WithError(err).Error("error marshalling pin attachments to json")
+		return pe.ErrServiceFailure("error saving pin").WithCause(err)
+	}
+	// upserts vary across dialects, hence the pin is replaced as a whole
+	return s.tx(ctx, "error saving pin", func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, s.q(`DELETE FROM pins WHERE id = ?`), p.ID); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, s.q(`INSERT INTO pins (`+sqlPinColumns+`)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+			p.ID, p.OwnerID, int(p.Mode), p.CreationTime.UnixNano(), int64(p.GoodFor), p.ReadAndBurn,
+			int64(p.ViewCount), p.Title, p.Note, int(p.NotifyOnView), p.NotifyAddr, string(attachments),
+			p.CreationTime.Add(p.GoodFor).UnixNano())
+		return err
+	})
+}
+
+func (s *SQLStore) Extend(ctx context.Context, p *md.Pin, extendBy, max time.Duration) (time.Duration, *pe.PinErr) {
+	var goodFor time.Duration
+	err := s.tx(ctx, "error extending pin", func(tx *sql.Tx) error {
+		sp, err := s.pin(ctx, tx, p.ID, true)
+		if err != nil {
+			return err
+		}
+		if sp.Burnt() {
+			return pe.ErrNotFound(fmt.Sprintf("pin %s not found", p.ID))
+		}
+		if goodFor = sp.GoodFor + extendBy; goodFor > max {
+			return errExtendBeyond(max)
+		}
+		expiry := p.CreationTime.Add(goodFor).UnixNano()
+		if _, err := tx.ExecContext(ctx, s.q(`UPDATE pins SET good_for = ?, expiry = ? WHERE id = ?`),
+			int64(goodFor), expiry, p.ID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, s.q(`UPDATE registrations SET score = ? WHERE pin_id = ? AND score IS NOT NULL`),
+			expiry, p.ID); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, s.q(`UPDATE access_logs SET expiry = ? WHERE pin_id = ?`), expiry, p.ID)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return goodFor, nil
+}
+
+func (s *SQLStore) Delete(ctx context.Context, pinID string) *pe.PinErr {
+	return s.exec(ctx, "error deleting pin", `DELETE FROM pins WHERE id = ?`, pinID)
+}
+
+func (s *SQLStore) Junk(ctx context.Context, max int) ([]*md.Junk, *pe.PinErr) {
+	const errMsg = "error loading junk pins"
+	if max < 0 {
+		return nil, pe.ErrBadInput(fmt.Sprintf("got negative max item count %d", max))
+	}
+	query := `SELECT r.pin_id, r.owner_id, r.refs, r.score, f.attempts, f.expiry
+		FROM registrations r LEFT JOIN junk_failures f ON f.pin_id = r.pin_id
+		WHERE r.score <= ? ORDER BY r.score, r.pin_id`
+	if max > 0 {
+		query += ` LIMIT ` + strconv.Itoa(max)
+	}
+	rows, err := s.DB.QueryContext(ctx, s.q(query), time.Now().UnixNano())
+	if err != nil {
+		logging.WithFuncName().WithContext(ctx).WithError(err).Error(errMsg)
+		return nil, pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	defer rows.Close()
+	jks := []*md.Junk{}
+	for rows.Next() {
+		var (
+			jk            md.Junk
+			refs          string
+			score         int64
+			attempts      sql.NullInt64
+			failureExpiry sql.NullInt64
+		)
+		if err := rows.Scan(&jk.PinID, &jk.OwnerID, &refs, &score, &attempts, &failureExpiry); err != nil {
+			return nil, pe.ErrServiceFailure(errMsg).WithCause(err)
+		}
+		if err := json.Unmarshal([]byte(refs), &jk.FileRefs); err != nil {
+			return nil, pe.ErrServiceFailure(errMsg).WithCause(err)
+		}
+		jk.Expiry = time.Unix(0, score)
+		if attempts.Valid {
+			jk.Expiry, jk.Attempts = time.Unix(0, failureExpiry.Int64), int(attempts.Int64)
+		}
+		jks = append(jks, &jk)
+	}
+	if err := rows.Err(); err != nil {
+		logging.WithFuncName().WithContext(ctx).WithError(err).Error(errMsg)
+		return nil, pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	return jks, nil
+}
+
+func (s *SQLStore) JunkCount(ctx context.Context) (int64, *pe.PinErr) {
+	var n int64
+	err := s.DB.QueryRowContext(ctx, s.q(`SELECT COUNT(*) FROM registrations WHERE score <= ?`),
+		time.Now().UnixNano()).Scan(&n)
+	if err != nil {
+		logging.WithFuncName().WithContext(ctx).WithError(err).Error("error counting junk pins")
+		return 0, pe.ErrServiceFailure("error counting junk pins").WithCause(err)
+	}
+	return n, nil
+}
+
+func (s *SQLStore) Refs(ctx context.Context, pinID string) ([]string, *pe.PinErr) {
+	const errMsg = "error getting pin attachment refs"
+	var refs string
+	err := s.DB.QueryRowContext(ctx, s.q(`SELECT refs FROM registrations WHERE pin_id = ?`), pinID).Scan(&refs)
+	if err == sql.ErrNoRows {
+		return nil, pe.ErrNotFound(fmt.Sprintf("pin %s not registered", pinID))
+	}
+	if err != nil {
+		logging.WithFuncName().WithContext(ctx).WithError(err).Error(errMsg)
+		return nil, pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	var rs []string
+	if err := json.Unmarshal([]byte(refs), &rs); err != nil {
+		return nil, pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	return rs, nil
+}
+
+// Claim takes over expired leases only, and relies on the unique key of leases for the rest: the row lock taken
+// upon reading the lease covers nothing if there is none, e.g. on Postgres and MySQL in READ COMMITTED, where a
+// concurrent claim may insert a lease in the meantime. Such races are reasoned about rather than tested, since
+// tests run against SQLite only, which serializes transactions
+func (s *SQLStore) Claim(ctx context.Context, pinID, holder string, ttl time.Duration) (bool, *pe.PinErr) {
+	claimed := false
+	err := s.tx(ctx, "error claiming junk pin", func(tx *sql.Tx) error {
+		now := time.Now().UnixNano()
+		var expiry int64
+		err := tx.QueryRowContext(ctx, s.q(`SELECT expiry FROM leases WHERE pin_id = ?`+s.forUpdate()), pinID).
+			Scan(&expiry)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if err == nil && expiry > now {
+			return nil
+		}
+		if _, err := tx.ExecContext(ctx, s.q(`DELETE FROM leases WHERE pin_id = ? AND expiry <= ?`), pinID, now); err != nil {
+			return err
+		}
+		// a concurrent claim may insert the lease first, upon which the claim fails on the unique key
+		if _, err := tx.ExecContext(ctx, s.q(`INSERT INTO leases (pin_id, holder, expiry) VALUES (?, ?, ?)`),
+			pinID, holder, now+int64(ttl)); err != nil {
+			if isUniqueViolation(err) {
+				return errLeaseTaken
+			}
+			return err
+		}
+		claimed = true
+		return nil
+	})
+	if err == errLeaseTaken {
+		return false, nil
+	}
+	return claimed, err
+}
+
+// errLeaseTaken aborts claims losing the race to insert the lease
+var errLeaseTaken = pe.ErrConflict("lease taken by another holder")
+
+func (s *SQLStore) Renew(ctx context.Context, pinID, holder string, ttl time.Duration) (bool, *pe.PinErr) {
+	const errMsg = "error renewing lease on junk pin"
+	now := time.Now().UnixNano()
+	res, err := s.DB.ExecContext(ctx, s.q(`UPDATE leases SET expiry = ? WHERE pin_id = ? AND holder = ? AND expiry > ?`),
+		now+int64(ttl), pinID, holder, now)
+	if err != nil {
+		logging.WithFuncName().WithContext(ctx).WithError(err).Error(errMsg)
+		return false, pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	return n > 0, nil
+}
+
+func (s *SQLStore) Release(ctx context.Context, pinID, holder string) *pe.PinErr {
+	return s.exec(ctx, "error releasing junk pin", `DELETE FROM leases WHERE pin_id = ? AND holder = ?`, pinID, holder)
+}
+
+func (s *SQLStore) Fail(ctx context.Context, f *md.JunkFailure, retryAt time.Time, quarantine bool) *pe.PinErr {
+	return s.tx(ctx, "error recording junk pin deletion failure", func(tx *sql.Tx) error {
+		var quarantineTime interface{}
+		if quarantine {
+			quarantineTime = f.LastAttempt.UnixNano()
+		}
+		if _, err := tx.ExecContext(ctx, s.q(`DELETE FROM junk_failures WHERE pin_id = ?`), f.PinID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, s.q(`INSERT INTO junk_failures
+			(pin_id, attempts, last_err, last_attempt, expiry, quarantine_time) VALUES (?, ?, ?, ?, ?, ?)`),
+			f.PinID, f.Attempts, f.LastErr, f.LastAttempt.UnixNano(), f.Expiry.UnixNano(), quarantineTime); err != nil {
+			return err
+		}
+		var score interface{}
+		if !quarantine {
+			score = retryAt.UnixNano()
+		}
+		_, err := tx.ExecContext(ctx, s.q(`UPDATE registrations SET score = ? WHERE pin_id = ? AND score IS NOT NULL`),
+			score, f.PinID)
+		return err
+	})
+}
+
+func (s *SQLStore) Quarantined(ctx context.Context) ([]*md.JunkFailure, *pe.PinErr) {
+	const errMsg = "error listing quarantined junk pins"
+	rows, err := s.DB.QueryContext(ctx, `SELECT pin_id, attempts, last_err, last_attempt, expiry FROM junk_failures
+		WHERE quarantine_time IS NOT NULL ORDER BY quarantine_time, pin_id`)
+	if err != nil {
+		logging.WithFuncName().WithContext(ctx).WithError(err).Error(errMsg)
+		return nil, pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	defer rows.Close()
+	fs := []*md.JunkFailure{}
+	for rows.Next() {
+		var (
+			f                   md.JunkFailure
+			lastAttempt, expiry int64
+		)
+		if err := rows.Scan(&f.PinID, &f.Attempts, &f.LastErr, &lastAttempt, &expiry); err != nil {
+			return nil, pe.ErrServiceFailure(errMsg).WithCause(err)
+		}
+		f.LastAttempt, f.Expiry = time.Unix(0, lastAttempt), time.Unix(0, expiry)
+		fs = append(fs, &f)
+	}
+	if err := rows.Err(); err != nil {
+		logging.WithFuncName().WithContext(ctx).WithError(err).Error(errMsg)
+		return nil, pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	return fs, nil
+}
+
+// quarantined returns an error of code ErrCodeNotFound unless the given junk pin is quarantined
+func (s *SQLStore) quarantined(ctx context.Context, tx *sql.Tx, pinID string) error {
+	ok, err := s.exists(ctx, tx, "junk_failures", " AND quarantine_time IS NOT NULL", pinID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return pe.ErrNotFound(fmt.Sprintf("junk pin %s is not quarantined", pinID))
+	}
+	return nil
+}
+
+func (s *SQLStore) Requeue(ctx context.Context, pinID string) *pe.PinErr {
+	return s.tx(ctx, "error requeuing junk pin", func(tx *sql.Tx) error {
+		if err := s.quarantined(ctx, tx, pinID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, s.q(`DELETE FROM junk_failures WHERE pin_id = ?`), pinID); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, s.q(`UPDATE registrations SET score = ? WHERE pin_id = ?`),
+			time.Now().UnixNano(), pinID)
+		return err
+	})
+}
+
+func (s *SQLStore) Discard(ctx context.Context, pinID string) *pe.PinErr {
+	return s.tx(ctx, "error discarding junk pin", func(tx *sql.Tx) error {
+		if err := s.quarantined(ctx, tx, pinID); err != nil {
+			return err
+		}
+		return s.deregister(ctx, tx, pinID)
+	})
+}
+
+func (s *SQLStore) Ping(ctx context.Context) *pe.PinErr {
+	if err := s.DB.PingContext(ctx); err != nil {
+		return pe.ErrServiceFailure("error pinging database").WithCause(err)
+	}
+	return nil
+}
+
+func (s *SQLStore) Close() *pe.PinErr {
+	if err := s.DB.Close(); err != nil {
+		return pe.ErrServiceFailure("error closing database").WithCause(err)
+	}
+	return nil
+}
+
+func (s *SQLStore) SaveWebhook(ctx context.Context, h *md.Webhook) *pe.PinErr {
+	const errMsg = "error saving webhook"
+	data, err := json.Marshal(h)
+	if err != nil {
+		logging.WithFuncName().WithContext(ctx).WithError(err).Error("error marshalling webhook to json")
+		return pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	return s.tx(ctx, errMsg, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, s.q(`DELETE FROM webhooks WHERE id = ?`), h.ID); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, s.q(`INSERT INTO webhooks (id, owner_id, data) VALUES (?, ?, ?)`),
+			h.ID, h.OwnerID, string(data))
+		return err
+	})
+}
+
+func (s *SQLStore) Webhooks(ctx context.Context, ownerID string) ([]*md.Webhook, *pe.PinErr) {
+	const errMsg = "error listing webhooks"
+	hooks := []*md.Webhook{}
+	err := s.scanJSON(ctx, func(data []byte) error {
+		var h md.Webhook
+		if err := json.Unmarshal(data, &h); err != nil {
+			return err
+		}
+		hooks = append(hooks, &h)
+		return nil
+	}, `SELECT data FROM webhooks WHERE owner_id = ? ORDER BY id`, ownerID)
+	if err != nil {
+		logging.WithFuncName().WithContext(ctx).WithError(err).Error(errMsg)
+		return nil, pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	return hooks, nil
+}
+
+func (s *SQLStore) DeleteWebhook(ctx context.Context, ownerID, hookID string) *pe.PinErr {
+	return s.tx(ctx, "error deleting webhook", func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, s.q(`DELETE FROM webhooks WHERE id = ? AND owner_id = ?`), hookID, ownerID)
+		if err != nil {
+			return err
+		}
+		// deliveries of webhooks owned by others are left alone
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, s.q(`DELETE FROM deliveries WHERE hook_id = ?`), hookID)
+		return err
+	})
+}
+
+func (s *SQLStore) LogDelivery(ctx context.Context, d *md.Delivery) *pe.PinErr {
+	const errMsg = "error logging webhook delivery"
+	data, err := json.Marshal(d)
+	if err != nil {
+		logging.WithFuncName().WithContext(ctx).WithError(err).Error("error marshalling webhook delivery to json")
+		return pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	return s.tx(ctx, errMsg, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, s.q(`INSERT INTO deliveries (id, hook_id, delivery_time, data) VALUES (?, ?, ?, ?)`),
+			d.ID, d.HookID, d.Time.UnixNano(), string(data)); err != nil {
+			return err
+		}
+		return s.trim(ctx, tx, "deliveries", "hook_id", "delivery_time", d.HookID, maxDeliveryLogSize)
+	})
+}
+
+func (s *SQLStore) Deliveries(ctx context.Context, hookID string, max int) ([]*md.Delivery, *pe.PinErr) {
+	const errMsg = "error listing webhook deliveries"
+	if max < 0 {
+		return nil, pe.ErrBadInput(fmt.Sprintf("got negative max item count %d", max))
+	}
+	query := `SELECT data FROM deliveries WHERE hook_id = ? ORDER BY delivery_time DESC, id DESC`
+	if max > 0 {
+		query += ` LIMIT ` + strconv.Itoa(max)
+	}
+	ds := []*md.Delivery{}
+	err := s.scanJSON(ctx, func(data []byte) error {
+		var d md.Delivery
+		if err := json.Unmarshal(data, &d); err != nil {
+			return err
+		}
+		ds = append(ds, &d)
+		return nil
+	}, query, hookID)
+	if err != nil {
+		logging.WithFuncName().WithContext(ctx).WithError(err).Error(errMsg)
+		return nil, pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	return ds, nil
+}
+
+// scanJSON runs query selecting a single column of JSON data, and calls fn with the data of every row
+func (s *SQLStore) scanJSON(ctx context.Context, fn func(data []byte) error, query string, args ...interface{}) error {
+	rows, err := s.DB.QueryContext(ctx, s.q(query), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return err
+		}
+		if err := fn([]byte(data)); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// trim keeps the latest max rows of log table by the given time column among rows whose key column equals key.
+// Rows as old as the oldest one to keep may go along with the rest
+func (s *SQLStore) trim(ctx context.Context, tx *sql.Tx, table, keyColumn, timeColumn, key string, max int) error {
+	var oldest int64
+	err := tx.QueryRowContext(ctx, s.q(fmt.Sprintf(`SELECT %s FROM %s WHERE %s = ? ORDER BY %s DESC LIMIT 1 OFFSET %d`,
+		timeColumn, table, keyColumn, timeColumn, max)), key).Scan(&oldest)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, s.q(fmt.Sprintf(`DELETE FROM %s WHERE %s = ? AND %s <= ?`, table, keyColumn, timeColumn)),
+		key, oldest)
+	return err
+}
+
+// sqlPurgePeriod is the least period between purges of expired throttle state
+const sqlPurgePeriod = time.Minute
+
+// purge drops expired throttle state, which is otherwise overwritten upon access only. Purges happen once per
+// sqlPurgePeriod at most across callers; failures are left to the next one
+func (s *SQLStore) purge(ctx context.Context, now time.Time) {
+	last := atomic.LoadInt64(&s.lastPurge)
+	if now.UnixNano()-last < int64(sqlPurgePeriod) || !atomic.CompareAndSwapInt64(&s.lastPurge, last, now.UnixNano()) {
+		return
+	}
+	for _, table := range []string{"throttle_keys", "throttle_counters", "throttle_hits"} {
+		if _, err := s.DB.ExecContext(ctx, s.q(`DELETE FROM `+table+` WHERE expiry <= ?`), now.UnixNano()); err != nil {
+			logging.WithFuncName().WithContext(ctx).WithError(err).WithField("table", table).Warn("error purging expired throttle state")
+		}
+	}
+}
+
+// Acquire takes over expired keys only and relies on the unique key of throttle keys for the rest, much like Claim
+func (s *SQLStore) Acquire(ctx context.Context, key string, period time.Duration) (bool, *pe.PinErr) {
+	now := time.Now()
+	s.purge(ctx, now)
+	acquired := false
+	err := s.tx(ctx, "error acquiring throttle key", func(tx *sql.Tx) error {
+		var expiry int64
+		err := tx.QueryRowContext(ctx, s.q(`SELECT expiry FROM throttle_keys WHERE name = ?`+s.forUpdate()), key).
+			Scan(&expiry)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if err == nil && expiry > now.UnixNano() {
+			return nil
+		}
+		if _, err := tx.ExecContext(ctx, s.q(`DELETE FROM throttle_keys WHERE name = ? AND expiry <= ?`),
+			key, now.UnixNano()); err != nil {
+			return err
+		}
+		// a concurrent caller may insert the key first, upon which the acquisition fails on the unique key
+		if _, err := tx.ExecContext(ctx, s.q(`INSERT INTO throttle_keys (name, expiry) VALUES (?, ?)`),
+			key, now.Add(period).UnixNano()); err != nil {
+			if isUniqueViolation(err) {
+				return errLeaseTaken
+			}
+			return err
+		}
+		acquired = true
+		return nil
+	})
+	if err == errLeaseTaken {
+		return false, nil
+	}
+	return acquired, err
+}
+
+// Allow counts hits of key in the window by rows of throttle_hits. Concurrent hits may both see room for one
+// more hit on databases locking rows rather than whole tables, hence the limit is approximate there
+func (s *SQLStore) Allow(ctx context.Context, key string, limit int, window time.Duration) (bool, time.Duration, *pe.PinErr) {
+	if limit <= 0 || window <= 0 {
+		return false, 0, pe.ErrBadInput("rate limit and window size must be positive")
+	}
+	now := time.Now()
+	s.purge(ctx, now)
+	var (
+		allowed bool
+		wait    time.Duration
+	)
+	err := s.tx(ctx, "error rate limiting", func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, s.q(`DELETE FROM throttle_hits WHERE name = ? AND hit_time <= ?`),
+			key, now.Add(-window).UnixNano()); err != nil {
+			return err
+		}
+		var (
+			n      int
+			oldest sql.NullInt64
+		)
+		if err := tx.QueryRowContext(ctx, s.q(`SELECT COUNT(*), MIN(hit_time) FROM throttle_hits WHERE name = ?`), key).
+			Scan(&n, &oldest); err != nil {
+			return err
+		}
+		if n >= limit {
+			if wait = time.Unix(0, oldest.Int64).Add(window).Sub(now); wait < time.Millisecond {
+				wait = time.Millisecond
+			}
+			return nil
+		}
+		allowed = true
+		_, err := tx.ExecContext(ctx, s.q(`INSERT INTO throttle_hits (name, hit_time, expiry) VALUES (?, ?, ?)`),
+			key, now.UnixNano(), now.Add(window).UnixNano())
+		return err
+	})
+	if err != nil {
+		return false, 0, err
+	}
+	return allowed, wait, nil
+}
+
+func (s *SQLStore) Count(ctx context.Context, key string, delta int64, window time.Duration) (int64, *pe.PinErr) {
+	now := time.Now()
+	s.purge(ctx, now)
+	var n int64
+	count := func(tx *sql.Tx) error {
+		var expiry int64
+		err := tx.QueryRowContext(ctx, s.q(`SELECT hits, expiry FROM throttle_counters WHERE name = ?`+s.forUpdate()), key).
+			Scan(&n, &expiry)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if err == nil && expiry > now.UnixNano() {
+			n += delta
+			_, err := tx.ExecContext(ctx, s.q(`UPDATE throttle_counters SET hits = ? WHERE name = ?`), n, key)
+			return err
+		}
+		// the window starts upon the first count. Counters started concurrently are left to the unique key
+		if _, err := tx.ExecContext(ctx, s.q(`DELETE FROM throttle_counters WHERE name = ? AND expiry <= ?`),
+			key, now.UnixNano()); err != nil {
+			return err
+		}
+		n = delta
+		_, err = tx.ExecContext(ctx, s.q(`INSERT INTO throttle_counters (name, hits, expiry) VALUES (?, ?, ?)`),
+			key, n, now.Add(window).UnixNano())
+		if err != nil && isUniqueViolation(err) {
+			return errLeaseTaken
+		}
+		return err
+	}
+	const errMsg = "error counting throttle key"
+	err := s.tx(ctx, errMsg, count)
+	// a concurrent caller started the window first, which is counted towards instead
+	if err == errLeaseTaken {
+		err = s.tx(ctx, errMsg, count)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (s *SQLStore) LogAccess(ctx context.Context, pinID string, a *md.Access, expiry time.Time) *pe.PinErr {
+	const errMsg = "error logging pin access"
+	data, err := json.Marshal(a)
+	if err != nil {
+		logging.WithFuncName().WithContext(ctx).WithError(err).Error("error marshalling pin access to json")
+		return pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	return s.tx(ctx, errMsg, func(tx *sql.Tx) error {
+		// an expired log starts over
+		if _, err := tx.ExecContext(ctx, s.q(`DELETE FROM access_logs WHERE pin_id = ? AND expiry <= ?`),
+			pinID, time.Now().UnixNano()); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, s.q(`INSERT INTO access_logs (pin_id, access_time, data, expiry) VALUES (?, ?, ?, ?)`),
+			pinID, a.Time.UnixNano(), string(data), expiry.UnixNano()); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, s.q(`UPDATE access_logs SET expiry = ? WHERE pin_id = ?`),
+			expiry.UnixNano(), pinID); err != nil {
+			return err
+		}
+		return s.trim(ctx, tx, "access_logs", "pin_id", "access_time", pinID, maxAccessLogSize)
+	})
+}
+
+func (s *SQLStore) AccessLog(ctx context.Context, pinID string) ([]*md.Access, *pe.PinErr) {
+	const errMsg = "error getting pin access log"
+	as := []*md.Access{}
+	err := s.scanJSON(ctx, func(data []byte) error {
+		var a md.Access
+		if err := json.Unmarshal(data, &a); err != nil {
+			return err
+		}
+		as = append(as, &a)
+		return nil
+	}, `SELECT data FROM access_logs WHERE pin_id = ? AND expiry > ? ORDER BY access_time DESC`,
+		pinID, time.Now().UnixNano())
+	if err != nil {
+		logging.WithFuncName().WithContext(ctx).WithError(err).Error(errMsg)
+		return nil, pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	return as, nil
+}
+
+func (s *SQLStore) SaveToken(ctx context.Context, token string, u *md.User) *pe.PinErr {
+	const errMsg = "error saving API token"
+	data, err := json.Marshal(u)
+	if err != nil {
+		logging.WithFuncName().WithContext(ctx).WithError(err).Error("error marshalling token owner to JSON")
+		return pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	return s.tx(ctx, errMsg, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, s.q(`DELETE FROM tokens WHERE hash = ?`), hashToken(token)); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, s.q(`INSERT INTO tokens (hash, data) VALUES (?, ?)`), hashToken(token), string(data))
+		return err
+	})
+}
+
+func (s *SQLStore) UserByToken(ctx context.Context, token string) (*md.User, *pe.PinErr) {
+	const errMsg = "error looking up API token"
+	var u *md.User
+	err := s.scanJSON(ctx, func(data []byte) error {
+		u = &md.User{}
+		return json.Unmarshal(data, u)
+	}, `SELECT data FROM tokens WHERE hash = ?`, hashToken(token))
+	if err != nil {
+		logging.WithFuncName().WithContext(ctx).WithError(err).Error(errMsg)
+		return nil, pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	if u == nil {
+		return nil, pe.ErrNotFound("unknown API token")
+	}
+	return u, nil
+}
+
+func (s *SQLStore) RevokeToken(ctx context.Context, token string) *pe.PinErr {
+	return s.exec(ctx, "error revoking API token", `DELETE FROM tokens WHERE hash = ?`, hashToken(token))
+}
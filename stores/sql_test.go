@@ -0,0 +1,268 @@
+package stores
+
+import (
+	"context"
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	pe "wuyrush.io/pin/errors"
+	md "wuyrush.io/pin/models"
+)
+
+// newSQLiteStore returns a SQLStore on a SQLite database file under dir
+func newSQLiteStore(t *testing.T, dir string) *SQLStore {
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "pin.db")+"?_txlock=immediate&_busy_timeout=5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, perr := NewSQLStore(db, DialectSQLite)
+	if perr != nil {
+		t.Fatal(perr)
+	}
+	return s
+}
+
+func TestSQLStoreContract(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pin-sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	n := 0
+	testPinStoreContract(t, func() PinStore {
+		n++
+		sub := filepath.Join(dir, strconv.Itoa(n))
+		if err := os.Mkdir(sub, 0700); err != nil {
+			t.Fatal(err)
+		}
+		return newSQLiteStore(t, sub)
+	})
+}
+
+func TestSQLStoreReopen(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "pin-sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s := newSQLiteStore(t, dir)
+	p := &md.Pin{ID: "p", CreationTime: time.Now(), GoodFor: time.Hour}
+	if err := s.Register(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	// migrations already applied are skipped upon reopening
+	s = newSQLiteStore(t, dir)
+	defer s.Close()
+	if err := s.Register(ctx, p); err == nil || err.Code != pe.ErrCodeConflict {
+		t.Errorf("expected conflict registering pin twice, got %v", err)
+	}
+}
+
+func TestSQLStoreConcurrentBurn(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "pin-sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s := newSQLiteStore(t, dir)
+	defer s.Close()
+	p := &md.Pin{ID: "p", CreationTime: time.Now(), GoodFor: time.Hour, ReadAndBurn: true}
+	if err := s.Register(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	// concurrent views of a read-and-burn pin succeed once only
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		viewed int
+	)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.View(ctx, p.ID)
+			if err != nil && err.Code != pe.ErrCodeNotFound {
+				t.Error(err)
+			}
+			if err == nil {
+				mu.Lock()
+				viewed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if viewed != 1 {
+		t.Errorf("expected burnt pin viewed once, got %d views", viewed)
+	}
+}
+
+func TestSQLStoreConcurrentMigration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pin-sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// processes starting up on a fresh database migrate the schema once
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s, err := OpenSQLStore(DialectSQLite, filepath.Join(dir, "pin.db")+"?_txlock=immediate&_busy_timeout=5000")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			s.Close()
+		}()
+	}
+	wg.Wait()
+}
+
+func TestSQLStoreWebhooks(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "pin-sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s := newSQLiteStore(t, dir)
+	defer s.Close()
+	h := &md.Webhook{ID: "h", OwnerID: "alice", URL: "https://example.com/hook", CreationTime: time.Now()}
+	if err := s.SaveWebhook(ctx, h); err != nil {
+		t.Fatal(err)
+	}
+	if hooks, err := s.Webhooks(ctx, "alice"); err != nil || len(hooks) != 1 || hooks[0].URL != h.URL {
+		t.Errorf("expected webhook of alice listed, got %v, %v", hooks, err)
+	}
+	now := time.Now()
+	for i := 0; i < maxDeliveryLogSize+1; i++ {
+		d := &md.Delivery{ID: strconv.Itoa(i), HookID: h.ID, Time: now.Add(time.Duration(i) * time.Millisecond)}
+		if err := s.LogDelivery(ctx, d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ds, perr := s.Deliveries(ctx, h.ID, 0)
+	if perr != nil {
+		t.Fatal(perr)
+	}
+	if len(ds) != maxDeliveryLogSize || ds[0].ID != strconv.Itoa(maxDeliveryLogSize) {
+		t.Errorf("expected latest %d deliveries listed latest first, got %d starting from %s",
+			maxDeliveryLogSize, len(ds), ds[0].ID)
+	}
+	if _, err := s.Deliveries(ctx, h.ID, -1); err == nil || err.Code != pe.ErrCodeAPIBadRequest {
+		t.Errorf("expected negative max rejected, got %v", err)
+	}
+	// webhooks of others are left alone
+	if err := s.DeleteWebhook(ctx, "bob", h.ID); err != nil {
+		t.Fatal(err)
+	}
+	if ds, _ := s.Deliveries(ctx, h.ID, 1); len(ds) != 1 {
+		t.Errorf("expected deliveries kept deleting webhook of others, got %d", len(ds))
+	}
+	if err := s.DeleteWebhook(ctx, "alice", h.ID); err != nil {
+		t.Fatal(err)
+	}
+	hooks, _ := s.Webhooks(ctx, "alice")
+	ds, _ = s.Deliveries(ctx, h.ID, 0)
+	if len(hooks) != 0 || len(ds) != 0 {
+		t.Errorf("expected webhook deleted with its deliveries, got %d webhooks, %d deliveries", len(hooks), len(ds))
+	}
+}
+
+func TestSQLStoreThrottler(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "pin-sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s := newSQLiteStore(t, dir)
+	defer s.Close()
+	if ok, err := s.Acquire(ctx, "k", 50*time.Millisecond); !ok || err != nil {
+		t.Fatalf("expected key acquired, got %v, %v", ok, err)
+	}
+	if ok, err := s.Acquire(ctx, "k", 50*time.Millisecond); ok || err != nil {
+		t.Errorf("expected key held, got %v, %v", ok, err)
+	}
+	for i := 0; i < 2; i++ {
+		if ok, _, err := s.Allow(ctx, "r", 2, 50*time.Millisecond); !ok || err != nil {
+			t.Fatalf("expected hit %d allowed, got %v, %v", i, ok, err)
+		}
+	}
+	if ok, wait, err := s.Allow(ctx, "r", 2, 50*time.Millisecond); ok || wait <= 0 || err != nil {
+		t.Errorf("expected hit over limit denied with wait, got %v, %v, %v", ok, wait, err)
+	}
+	if _, _, err := s.Allow(ctx, "r", 0, time.Second); err == nil || err.Code != pe.ErrCodeAPIBadRequest {
+		t.Errorf("expected zero limit rejected, got %v", err)
+	}
+	for i := int64(1); i <= 2; i++ {
+		if n, err := s.Count(ctx, "c", 1, 50*time.Millisecond); n != i || err != nil {
+			t.Errorf("expected count %d, got %d, %v", i, n, err)
+		}
+	}
+	time.Sleep(60 * time.Millisecond)
+	if ok, err := s.Acquire(ctx, "k", time.Second); !ok || err != nil {
+		t.Errorf("expected expired key acquired, got %v, %v", ok, err)
+	}
+	if ok, _, err := s.Allow(ctx, "r", 2, 50*time.Millisecond); !ok || err != nil {
+		t.Errorf("expected hit allowed once window slides, got %v, %v", ok, err)
+	}
+	if n, err := s.Count(ctx, "c", 1, 50*time.Millisecond); n != 1 || err != nil {
+		t.Errorf("expected count restarted in new window, got %d, %v", n, err)
+	}
+}
+
+func TestSQLStoreAccessLog(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "pin-sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s := newSQLiteStore(t, dir)
+	defer s.Close()
+	now := time.Now()
+	for i := 0; i < maxAccessLogSize+1; i++ {
+		a := &md.Access{Time: now.Add(time.Duration(i) * time.Millisecond), Kind: strconv.Itoa(i)}
+		if err := s.LogAccess(ctx, "p", a, now.Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	as, perr := s.AccessLog(ctx, "p")
+	if perr != nil {
+		t.Fatal(perr)
+	}
+	if len(as) != maxAccessLogSize || as[0].Kind != strconv.Itoa(maxAccessLogSize) {
+		t.Errorf("expected latest %d accesses listed latest first, got %d starting from %s",
+			maxAccessLogSize, len(as), as[0].Kind)
+	}
+	// an expired log is gone, and starts over upon the next access
+	if err := s.LogAccess(ctx, "q", &md.Access{Time: now}, now.Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if as, _ := s.AccessLog(ctx, "q"); len(as) != 0 {
+		t.Errorf("expected expired access log empty, got %d accesses", len(as))
+	}
+	if err := s.LogAccess(ctx, "q", &md.Access{Time: now}, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if as, _ := s.AccessLog(ctx, "q"); len(as) != 1 {
+		t.Errorf("expected access log started over, got %d accesses", len(as))
+	}
+}
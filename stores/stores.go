@@ -2,9 +2,11 @@ package stores
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -18,6 +20,7 @@ import (
 	"github.com/spf13/viper"
 
 	"wuyrush.io/pin/common/logging"
+	"wuyrush.io/pin/common/pinid"
 	cst "wuyrush.io/pin/constants"
 	pe "wuyrush.io/pin/errors"
 	md "wuyrush.io/pin/models"
@@ -25,21 +28,91 @@ import (
 
 // PinStore vends the interface to interact with pin data.
 type PinStore interface {
-	Get(pinID string) (*md.Pin, *pe.PinErr)
-	// Register registers pin for bookkeeping purpose
-	Register(p *md.Pin) *pe.PinErr
+	Get(ctx context.Context, pinID string) (*md.Pin, *pe.PinErr)
+	// View gets pin data on behalf of a viewer. It increments the pin's view count and burns the pin if it is
+	// read-and-burn, both atomically. The returned pin reflects the view. Burnt pins cannot be viewed again, yet
+	// stay around for burnGrace so that Get keeps serving the viewer's follow-up requests, e.g. downloading
+	// attachments; they expire by then, or earlier if they are due to
+	View(ctx context.Context, pinID string) (*md.Pin, *pe.PinErr)
+	// Register registers pin for bookkeeping purpose. It returns an error of code ErrCodeConflict if a pin with
+	// the same ID had already been registered, which includes quarantined pins: they stay registered till
+	// discarded, though out of pin expiry index
+	Register(ctx context.Context, p *md.Pin) *pe.PinErr
 	// Deregister de-register pin from PinStore. Caller must ensure the pin data is all cleaned up before
 	// calling Deregister to avoid leaking pin data
-	Deregister(pinID string) *pe.PinErr
-	Save(p *md.Pin) *pe.PinErr
+	Deregister(ctx context.Context, pinID string) *pe.PinErr
+	Save(ctx context.Context, p *md.Pin) *pe.PinErr
+	// Extend adds extendBy to the good-for period of a saved pin as stored at the time, along with the pin's
+	// expiry which is counted from its creation time, and returns the extended good-for period. Extensions
+	// pushing the good-for period beyond max are rejected as bad input. Extend must read and update pin data and
+	// its registration atomically, so that concurrent extensions add up. Burnt pins cannot be extended
+	Extend(ctx context.Context, p *md.Pin, extendBy, max time.Duration) (time.Duration, *pe.PinErr)
 	// Delete deletes pin data from store. Delete must be idempotent
-	Delete(pinID string) *pe.PinErr
-	// Junk returns pins which shall be removed from PinStore of size max;
-	// It returns all junk pins when max == 0
-	Junk(max int) ([]*md.Junk, *pe.PinErr)
+	Delete(ctx context.Context, pinID string) *pe.PinErr
+	// Junk returns pins which shall be removed from PinStore of size max, in order of their scores in pin expiry
+	// index; It returns all junk pins when max == 0. A pin is scored by its expiry till it fails to be deleted,
+	// upon which it is re-scored by its retry time for backoff, and its expiry is kept in its failure record
+	Junk(ctx context.Context, max int) ([]*md.Junk, *pe.PinErr)
+	// JunkCount returns the number of pins which shall be removed from PinStore
+	JunkCount(ctx context.Context) (int64, *pe.PinErr)
+	// Refs returns references of attachments of a registered pin. It returns an error of code ErrCodeNotFound if
+	// the pin is not registered
+	Refs(ctx context.Context, pinID string) ([]string, *pe.PinErr)
+	// Claim leases junk pin to holder for ttl, so that deleter replicas sharing PinStore never dispose of the same
+	// junk pin at the same time. It reports whether the claim succeeds, aka nobody else holds the lease. Leases
+	// of crashed holders become available again once they run out
+	Claim(ctx context.Context, pinID, holder string, ttl time.Duration) (bool, *pe.PinErr)
+	// Renew extends the lease on junk pin to ttl from now, if it is still held by holder. It reports whether the
+	// lease is renewed, so that holders learn when they had lost it
+	Renew(ctx context.Context, pinID, holder string, ttl time.Duration) (bool, *pe.PinErr)
+	// Release gives up the lease on junk pin, if it is still held by holder. Release must be idempotent
+	Release(ctx context.Context, pinID, holder string) *pe.PinErr
+	// Fail records failed attempt f to delete junk pin. The pin is either retried no earlier than retryAt, or
+	// quarantined, after which Junk no longer returns it
+	Fail(ctx context.Context, f *md.JunkFailure, retryAt time.Time, quarantine bool) *pe.PinErr
+	// Quarantined returns failure records of all quarantined junk pins in order of their quarantine time, aka
+	// their last failed attempts
+	Quarantined(ctx context.Context) ([]*md.JunkFailure, *pe.PinErr)
+	// Requeue moves quarantined junk pin back for deletion, with its failed attempts forgotten. It returns an
+	// error of code ErrCodeNotFound if the pin is not quarantined
+	Requeue(ctx context.Context, pinID string) *pe.PinErr
+	// Discard deregisters quarantined junk pin without deleting its attachments. It returns an error of code
+	// ErrCodeNotFound if the pin is not quarantined
+	Discard(ctx context.Context, pinID string) *pe.PinErr
+	// Ping checks whether PinStore is able to serve requests
+	Ping(ctx context.Context) *pe.PinErr
 	Close() *pe.PinErr
 }
 
+// Store is served by PinStore backends, which keep the rest of application data along with pins.
+type Store interface {
+	PinStore
+	WebhookStore
+	Throttler
+	AccessLogStore
+	TokenStore
+}
+
+// names of store backends to select by configuration
+const (
+	BackendRedis  = "redis"
+	BackendMemory = "memory"
+	BackendBolt   = "bolt"
+	BackendSQL    = "sql"
+	BackendLocal  = "local"
+)
+
+// burnGrace is how long a burnt pin stays around after its view
+var burnGrace = 5 * time.Minute
+
+// burnExpiry returns the expiry of a pin burnt at now, given the pin was due to expire at expiry
+func burnExpiry(now, expiry time.Time) time.Time {
+	if at := now.Add(burnGrace); at.Before(expiry) {
+		return at
+	}
+	return expiry
+}
+
 // RedisStore is a PinStore implementation driven by Redis.
 type RedisStore struct {
 	DB *redis.Client
@@ -55,27 +128,36 @@ const (
 	fieldNameTitle        = "title"
 	fieldNameNote         = "note"
 	fieldNameAttachments  = "attachments"
+	fieldNameNotifyOnView = "notifyOnView"
+	fieldNameNotifyAddr   = "notifyAddr"
 
 	// redis key of the sorted set whose score is pin expiry
 	keyPinExpirySet = "pinExpirySet"
 	// template to form an unique identifier for pin attachment refs
 	keyTmplRefs = `refs.%s`
+	// template to form an unique identifier for pin owner id
+	keyTmplOwner = `owner.%s`
 )
 
-func (s *RedisStore) Register(p *md.Pin) *pe.PinErr {
+// scriptRegister indexes pin by its expiry and caches pin data necessary for future cleanup in one go, so that
+// a pin is never registered partially. Pin owner is cached only if the pin has one.
+// KEYS: pin expiry index key, pin attachment refs key, pin owner key
+// ARGV: expiry in unix seconds, pin ID, attachment refs in JSON, owner ID
+var scriptRegister = redis.NewScript(`
+if redis.call("ZADD", KEYS[1], "NX", ARGV[1], ARGV[2]) == 0 then
+	return 0
+end
+redis.call("SET", KEYS[2], ARGV[3])
+if ARGV[4] ~= "" then
+	redis.call("SET", KEYS[3], ARGV[4])
+end
+return 1
+`)
+
+func (s *RedisStore) Register(ctx context.Context, p *md.Pin) *pe.PinErr {
 	const errMsg = "error registering pin"
-	clog := log.WithField("pinID", p.ID)
+	clog := log.WithContext(ctx).WithField("pinID", p.ID)
 	expiry := p.CreationTime.Add(p.GoodFor).Unix()
-	// add pin ID to sorted set for future lookup
-	member := redis.Z{
-		Score:  float64(expiry),
-		Member: p.ID,
-	}
-	if _, err := s.DB.ZAddNX(keyPinExpirySet, member).Result(); err != nil {
-		clog.WithError(err).Error("Register: error calling Redis to index pin id")
-		return pe.ErrServiceFailure(errMsg).WithCause(err)
-	}
-	// cache necessary pin data for future cleanup
 	refs, cnt := make([]string, len(p.Attachments)), 0
 	for _, ref := range p.Attachments {
 		refs[cnt] = ref
@@ -86,36 +168,49 @@ func (s *RedisStore) Register(p *md.Pin) *pe.PinErr {
 		clog.WithError(err).Error("Register: error marshalling pin attachment references to json")
 		return pe.ErrServiceFailure(errMsg).WithCause(err)
 	}
-	refsKey := s.refsKey(p.ID)
-	if _, err := s.DB.Set(refsKey, refsByte, time.Duration(0)).Result(); err != nil {
-		clog.WithError(err).WithField("refsKey", refsKey).Error("Register: error calling Redis to save pin attachment refs")
+	keys := []string{keyPinExpirySet, s.refsKey(p.ID), s.ownerKey(p.ID)}
+	added, err := scriptRegister.Run(s.DB, keys, expiry, p.ID, refsByte, p.OwnerID).Int()
+	if err != nil {
+		clog.WithError(err).Error("Register: error calling Redis to register pin")
 		return pe.ErrServiceFailure(errMsg).WithCause(err)
 	}
+	// pin ID is taken by another pin
+	if added == 0 {
+		clog.Warn("Register: pin id collision")
+		return pe.ErrConflict(fmt.Sprintf("pin %s already exists", p.ID))
+	}
 	return nil
 }
 
-func (s *RedisStore) Deregister(pinID string) *pe.PinErr {
+func (s *RedisStore) Deregister(ctx context.Context, pinID string) *pe.PinErr {
 	const errMsg = "error deregistering pin"
-	clog := log.WithField("pinID", pinID)
-	// remove pin attachment refs data if any
-	refsKey := s.refsKey(pinID)
-	// redis ignores the error upon DEL if the key is non-existent
-	if _, err := s.DB.Del(refsKey).Result(); err != nil {
-		clog.WithError(err).WithField("refsKey", refsKey).Error("Deregister: error calling redis to remove pin attachment refs")
-		return pe.ErrServiceFailure(errMsg).WithCause(err)
-	}
-	// remove pin id from index
-	// redis ignores the error upon ZREM if the key is non-existent
-	if _, err := s.DB.ZRem(keyPinExpirySet, pinID).Result(); err != nil {
-		clog.WithError(err).Error("Deregister: error calling redis to remove pin id from index")
+	clog := log.WithContext(ctx).WithField("pinID", pinID)
+	// remove pin attachment refs, owner, failure record and access log, whose absence redis ignores, along with
+	// pin id in index in one round trip. Access log expires along with pin in general, but a burnt pin goes away
+	// earlier
+	if _, err := s.DB.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.Del(s.refsKey(pinID), s.ownerKey(pinID), s.failureKey(pinID), s.accessLogKey(pinID))
+		pipe.ZRem(keyPinExpirySet, pinID)
+		return nil
+	}); err != nil {
+		clog.WithError(err).Error("Deregister: error calling redis to remove pin registration")
 		return pe.ErrServiceFailure(errMsg).WithCause(err)
 	}
 	return nil
 }
 
-func (s *RedisStore) Junk(max int) ([]*md.Junk, *pe.PinErr) {
+func (s *RedisStore) JunkCount(ctx context.Context) (int64, *pe.PinErr) {
+	n, err := s.DB.ZCount(keyPinExpirySet, "0", strconv.FormatInt(time.Now().Unix(), 10)).Result()
+	if err != nil {
+		logging.WithFuncName().WithContext(ctx).WithError(err).Error("error calling redis to count stale pins")
+		return 0, pe.ErrServiceFailure("error counting junk pins").WithCause(err)
+	}
+	return n, nil
+}
+
+func (s *RedisStore) Junk(ctx context.Context, max int) ([]*md.Junk, *pe.PinErr) {
 	const errMsg = "error loading junk pins"
-	clog := logging.WithFuncName()
+	clog := logging.WithFuncName().WithContext(ctx)
 	count := max
 	if max < 0 {
 		return nil, pe.ErrBadInput(fmt.Sprintf("got negative max item count %d", max))
@@ -125,14 +220,14 @@ func (s *RedisStore) Junk(max int) ([]*md.Junk, *pe.PinErr) {
 	// gather stale pin ids
 	now := time.Now().Unix()
 	opt := redis.ZRangeBy{Min: "0", Max: strconv.FormatInt(now, 10), Count: int64(count)}
-	ids, err := s.DB.ZRangeByScore(keyPinExpirySet, opt).Result()
+	zs, err := s.DB.ZRangeByScoreWithScores(keyPinExpirySet, opt).Result()
 	if err != nil {
 		clog.WithError(err).Error("error calling redis to get ids of stale pins")
 		return nil, pe.ErrServiceFailure(errMsg).WithCause(err)
 	}
-	clog.WithField("ids", ids).Debug("done loading junk pin ids")
+	clog.WithField("ids", zs).Debug("done loading junk pin ids")
 	// assemble junk pins and return
-	jks, err := s.junk(ids)
+	jks, err := s.junk(ctx, zs)
 	if err != nil {
 		return nil, pe.ErrServiceFailure(errMsg).WithCause(err)
 	}
@@ -140,8 +235,9 @@ func (s *RedisStore) Junk(max int) ([]*md.Junk, *pe.PinErr) {
 	return jks, nil
 }
 
-func (s *RedisStore) junk(ids []string) ([]*md.Junk, error) {
-	clog := logging.WithFuncName()
+// junk assembles junk pins out of their members in pin expiry index
+func (s *RedisStore) junk(ctx context.Context, zs []redis.Z) ([]*md.Junk, error) {
+	clog := logging.WithFuncName().WithContext(ctx)
 	// this concurrency setup guarantees following ordering: ALL GetPinRefFromRedis goroutine finish ->
 	// MakeErrStat goroutine gets the very last err and the goroutine executing junk() gets the last junk ->
 	// waiter goroutine unblocks from wait and closes done channel -> MakeErrStat and junk() goroutine exit.
@@ -149,7 +245,7 @@ func (s *RedisStore) junk(ids []string) ([]*md.Junk, error) {
 	quotas := make(chan struct{}, fpsize)
 	jkChan, errChan, done := make(chan *md.Junk), make(chan error), make(chan struct{})
 	var wg sync.WaitGroup
-	wg.Add(len(ids))
+	wg.Add(len(zs))
 	// waiter
 	go func() {
 		wg.Wait()
@@ -169,8 +265,8 @@ func (s *RedisStore) junk(ids []string) ([]*md.Junk, error) {
 	}()
 	// spawn assemblers
 	clog.WithField("fetcherPoolSize", fpsize).Debug("spawning fetchers")
-	for _, pinID := range ids {
-		go func(pinID string) {
+	for _, z := range zs {
+		go func(pinID string, expiry time.Time) {
 			// NOTE individual worker should be responsible for acquiring quota otherwise we risk blocking
 			// goroutine executing the enclosing function(in this case `junk()`)
 			quotas <- struct{}{}
@@ -189,11 +285,29 @@ func (s *RedisStore) junk(ids []string) ([]*md.Junk, error) {
 				errChan <- err
 				return
 			}
-			jkChan <- &md.Junk{PinID: pinID, FileRefs: *refs}
-		}(pinID)
+			// pins created in anonymous mode have no owner
+			ownerID, err := s.DB.Get(s.ownerKey(pinID)).Result()
+			if err != nil && err != redis.Nil {
+				clog.WithError(err).WithField("pinID", pinID).Error("error getting pin owner from redis")
+				errChan <- err
+				return
+			}
+			jk := &md.Junk{PinID: pinID, OwnerID: ownerID, FileRefs: *refs, Expiry: expiry}
+			// pins failed to be deleted before are re-scored for backoff, hence carry their expiry in failure record
+			f, err := s.failure(pinID)
+			if err != nil {
+				clog.WithError(err).WithField("pinID", pinID).Error("error getting pin failure record from redis")
+				errChan <- err
+				return
+			}
+			if f != nil {
+				jk.Expiry, jk.Attempts = f.Expiry, f.Attempts
+			}
+			jkChan <- jk
+		}(z.Member.(string), time.Unix(int64(z.Score), 0))
 	}
 	// goroutine executing this function to collect assembled junk pins
-	jks := make([]*md.Junk, 0, len(ids))
+	jks := make([]*md.Junk, 0, len(zs))
 	for {
 		select {
 		case jk := <-jkChan:
@@ -209,42 +323,121 @@ func (s *RedisStore) junk(ids []string) ([]*md.Junk, error) {
 	}
 }
 
+func (s *RedisStore) Refs(ctx context.Context, pinID string) ([]string, *pe.PinErr) {
+	const errMsg = "error loading pin attachment refs"
+	clog := logging.WithFuncName().WithContext(ctx).WithField("pinID", pinID)
+	v, err := s.DB.Get(s.refsKey(pinID)).Result()
+	if err == redis.Nil {
+		return nil, pe.ErrNotFound(fmt.Sprintf("pin %s not registered", pinID))
+	}
+	if err != nil {
+		clog.WithError(err).Error("error getting pin file refs from redis")
+		return nil, pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	refs := []string{}
+	if err := json.Unmarshal([]byte(v), &refs); err != nil {
+		clog.WithError(err).Error("error unmarshal pin file refs")
+		return nil, pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	return refs, nil
+}
+
 func (s *RedisStore) refsKey(pinID string) string {
 	return fmt.Sprintf(keyTmplRefs, pinID)
 }
 
-func (s *RedisStore) Save(p *md.Pin) *pe.PinErr {
+func (s *RedisStore) ownerKey(pinID string) string {
+	return fmt.Sprintf(keyTmplOwner, pinID)
+}
+
+func (s *RedisStore) Save(ctx context.Context, p *md.Pin) *pe.PinErr {
 	const errMsg = "error saving pin metadata"
-	clog := logging.WithFuncName().WithField("pinID", p.ID)
+	clog := logging.WithFuncName().WithContext(ctx).WithField("pinID", p.ID)
 	filesBytes, err := json.Marshal(p.Attachments)
 	if err != nil {
 		clog.WithError(err).Error("error marshalling pin attachment metadata to JSON")
 		return pe.ErrServiceFailure(errMsg).WithCause(err)
 	}
-	// hacks redis keys so that data in the nested object can be store in a flat map
-	if _, err := s.DB.HMSet(p.ID, map[string]interface{}{
-		fieldNameOwnerID:      p.OwnerID,
-		fieldNameMode:         int(p.Mode),
-		fieldNameViewCount:    p.ViewCount,
-		fieldNameCreationTime: p.CreationTime,
-		fieldNameGoodFor:      int64(p.GoodFor),
-		fieldNameReadAndBurn:  p.ReadAndBurn,
-		fieldNameTitle:        p.Title,
-		fieldNameNote:         p.Note,
-		fieldNameAttachments:  filesBytes,
-	}).Result(); err != nil {
+	// hacks redis keys so that data in the nested object can be store in a flat map. Pin data and its expiry are
+	// set in one transaction, otherwise a crash in between leaves pin data which never expires
+	expiry := p.CreationTime.Add(p.GoodFor)
+	if _, err := s.DB.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.HMSet(p.ID, map[string]interface{}{
+			fieldNameOwnerID:      p.OwnerID,
+			fieldNameMode:         int(p.Mode),
+			fieldNameViewCount:    p.ViewCount,
+			fieldNameCreationTime: p.CreationTime,
+			fieldNameGoodFor:      int64(p.GoodFor),
+			fieldNameReadAndBurn:  p.ReadAndBurn,
+			fieldNameTitle:        p.Title,
+			fieldNameNote:         p.Note,
+			fieldNameAttachments:  filesBytes,
+			fieldNameNotifyOnView: int(p.NotifyOnView),
+			fieldNameNotifyAddr:   p.NotifyAddr,
+		})
+		pipe.PExpireAt(p.ID, expiry)
+		return nil
+	}); err != nil {
 		clog.WithError(err).Error("error caching pin metadata in redis")
 		return pe.ErrServiceFailure(errMsg).WithCause(err)
 	}
-	if _, err := s.DB.Expire(p.ID, p.GoodFor).Result(); err != nil {
-		clog.WithError(err).Error("error setting pin's expiry")
-		return pe.ErrServiceFailure(errMsg).WithCause(err)
-	}
 	return nil
 }
 
-func (s *RedisStore) Get(pinID string) (*md.Pin, *pe.PinErr) {
-	clog := logging.WithFuncName().WithField("pinID", pinID)
+// scriptExtend adds to good-for period of a pin and updates its expiry, as well as its score in pin expiry index
+// and expiry of its access log in one go, so that concurrent extensions add up and deleter never sees a stale
+// expiry of an extended pin. It returns the extended good-for period, 0 if the pin is gone or burnt, or -1 if the
+// extension exceeds the cap. Good-for periods fit in Lua numbers without losing precision.
+// KEYS: pin key, pin expiry index key, pin access log key
+// ARGV: extension in nanoseconds, cap of good-for period in nanoseconds, creation time in unix milliseconds,
+// pin ID
+var scriptExtend = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return 0
+end
+if redis.call("HGET", KEYS[1], "` + fieldNameReadAndBurn + `") == "1" and
+	(tonumber(redis.call("HGET", KEYS[1], "` + fieldNameViewCount + `")) or 0) >= 1 then
+	return 0
+end
+local goodFor = (tonumber(redis.call("HGET", KEYS[1], "` + fieldNameGoodFor + `")) or 0) + tonumber(ARGV[1])
+if goodFor > tonumber(ARGV[2]) then
+	return -1
+end
+local expiry = tonumber(ARGV[3]) + math.floor(goodFor / 1000000)
+redis.call("HSET", KEYS[1], "` + fieldNameGoodFor + `", string.format("%.0f", goodFor))
+redis.call("PEXPIREAT", KEYS[1], string.format("%.0f", expiry))
+redis.call("ZADD", KEYS[2], "XX", string.format("%.0f", math.floor(expiry / 1000)), ARGV[4])
+redis.call("PEXPIREAT", KEYS[3], string.format("%.0f", expiry))
+return goodFor
+`)
+
+func (s *RedisStore) Extend(ctx context.Context, p *md.Pin, extendBy, max time.Duration) (time.Duration, *pe.PinErr) {
+	const errMsg = "error extending pin expiry"
+	clog := logging.WithFuncName().WithContext(ctx).WithField("pinID", p.ID)
+	keys := []string{p.ID, keyPinExpirySet, s.accessLogKey(p.ID)}
+	n, err := scriptExtend.Run(s.DB, keys,
+		int64(extendBy), int64(max), p.CreationTime.UnixNano()/int64(time.Millisecond), p.ID).Int64()
+	if err != nil {
+		clog.WithError(err).Error("error calling Redis to extend pin expiry")
+		return 0, pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	switch {
+	// pin had expired or burnt already
+	case n == 0:
+		return 0, pe.ErrNotFound(fmt.Sprintf("pin %s not found", p.ID))
+	case n < 0:
+		return 0, errExtendBeyond(max)
+	}
+	return time.Duration(n), nil
+}
+
+// errExtendBeyond returns the error of extending a pin beyond the cap of its good-for period
+func errExtendBeyond(max time.Duration) *pe.PinErr {
+	return pe.ErrBadInput(fmt.Sprintf("pin can live up to %s since its creation", max))
+}
+
+func (s *RedisStore) Get(ctx context.Context, pinID string) (*md.Pin, *pe.PinErr) {
+	clog := logging.WithFuncName().WithContext(ctx).WithField("pinID", pinID)
 	m, err := s.DB.HGetAll(pinID).Result()
 	if err != nil {
 		msg := "error getting pin data"
@@ -255,11 +448,74 @@ func (s *RedisStore) Get(pinID string) (*md.Pin, *pe.PinErr) {
 	if m == nil || len(m) == 0 {
 		return nil, pe.ErrNotFound(fmt.Sprintf("pin %s not found", pinID))
 	}
+	return s.pin(ctx, pinID, m)
+}
+
+// scriptView counts a view of pin and burns the pin if it is read-and-burn. A burnt pin expires at the end of
+// its grace period unless it is due earlier, and is re-scored in pin expiry index accordingly, so that deleters
+// pick it up upon its expiry
+// KEYS: pin key, pin expiry index key
+// ARGV: end of grace period in unix seconds, pin ID, current time in unix seconds
+var scriptView = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return {}
+end
+local burn = redis.call("HGET", KEYS[1], "` + fieldNameReadAndBurn + `") == "1"
+if burn and (tonumber(redis.call("HGET", KEYS[1], "` + fieldNameViewCount + `")) or 0) >= 1 then
+	return {}
+end
+redis.call("HINCRBY", KEYS[1], "` + fieldNameViewCount + `", 1)
+local data = redis.call("HGETALL", KEYS[1])
+if burn then
+	local ttl = redis.call("TTL", KEYS[1])
+	if ttl < 0 or tonumber(ARGV[3]) + ttl > tonumber(ARGV[1]) then
+		redis.call("EXPIREAT", KEYS[1], ARGV[1])
+	end
+	local score = redis.call("ZSCORE", KEYS[2], ARGV[2])
+	if score and tonumber(score) > tonumber(ARGV[1]) then
+		redis.call("ZADD", KEYS[2], "XX", ARGV[1], ARGV[2])
+	end
+end
+return data
+`)
+
+func (s *RedisStore) View(ctx context.Context, pinID string) (*md.Pin, *pe.PinErr) {
+	const errMsg = "error viewing pin"
+	clog := logging.WithFuncName().WithContext(ctx).WithField("pinID", pinID)
+	now := time.Now()
+	res, err := scriptView.Run(s.DB, []string{pinID, keyPinExpirySet}, now.Add(burnGrace).Unix(), pinID,
+		now.Unix()).Result()
+	if err != nil {
+		clog.WithError(err).Error("error calling Redis to view pin")
+		return nil, pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	vals, ok := res.([]interface{})
+	if !ok {
+		clog.WithField("result", res).Error("got unexpected result type from Redis")
+		return nil, pe.ErrServiceFailure(errMsg)
+	}
+	if len(vals) == 0 {
+		return nil, pe.ErrNotFound(fmt.Sprintf("pin %s not found", pinID))
+	}
+	// HGETALL replies field-value pairs in a flat array
+	m := make(map[string]string, len(vals)/2)
+	for i := 0; i+1 < len(vals); i += 2 {
+		k, _ := vals[i].(string)
+		v, _ := vals[i+1].(string)
+		m[k] = v
+	}
+	return s.pin(ctx, pinID, m)
+}
+
+// pin unmarshals pin data stored as Redis hash
+func (s *RedisStore) pin(ctx context.Context, pinID string, m map[string]string) (*md.Pin, *pe.PinErr) {
+	clog := logging.WithFuncName().WithContext(ctx).WithField("pinID", pinID)
 	p := &md.Pin{
-		ID:      pinID,
-		OwnerID: m[fieldNameOwnerID],
-		Title:   m[fieldNameTitle],
-		Note:    m[fieldNameNote],
+		ID:         pinID,
+		OwnerID:    m[fieldNameOwnerID],
+		Title:      m[fieldNameTitle],
+		Note:       m[fieldNameNote],
+		NotifyAddr: m[fieldNameNotifyAddr],
 	}
 	mode, err := strconv.Atoi(m[fieldNameMode])
 	if err != nil {
@@ -293,6 +549,25 @@ func (s *RedisStore) Get(pinID string) (*md.Pin, *pe.PinErr) {
 	}
 	p.GoodFor = time.Duration(gf)
 
+	rb, err := strconv.ParseBool(m[fieldNameReadAndBurn])
+	if err != nil {
+		msg := "error unmarshalling read-and-burn flag"
+		clog.WithError(err).Error(msg)
+		return nil, pe.ErrServiceFailure(msg).WithCause(err)
+	}
+	p.ReadAndBurn = rb
+
+	// pins saved before view notice was introduced don't carry the field
+	if v, ok := m[fieldNameNotifyOnView]; ok {
+		vn, err := strconv.Atoi(v)
+		if err != nil {
+			msg := "error unmarshalling view notice setting"
+			clog.WithError(err).Error(msg)
+			return nil, pe.ErrServiceFailure(msg).WithCause(err)
+		}
+		p.NotifyOnView = md.ViewNotice(vn)
+	}
+
 	attachments := make(map[string]string)
 	if m[fieldNameAttachments] != "" {
 		if err := json.Unmarshal([]byte(m[fieldNameAttachments]), &attachments); err != nil {
@@ -305,8 +580,8 @@ func (s *RedisStore) Get(pinID string) (*md.Pin, *pe.PinErr) {
 	return p, nil
 }
 
-func (s *RedisStore) Delete(pinID string) *pe.PinErr {
-	clog := logging.WithFuncName().WithField("pinID", pinID)
+func (s *RedisStore) Delete(ctx context.Context, pinID string) *pe.PinErr {
+	clog := logging.WithFuncName().WithContext(ctx).WithField("pinID", pinID)
 	// 1. attempt removing pin (meta)data
 	if _, err := s.DB.Del(pinID).Result(); err != nil && err != redis.Nil {
 		msg := "error deleting pin data from Redis"
@@ -316,6 +591,14 @@ func (s *RedisStore) Delete(pinID string) *pe.PinErr {
 	return nil
 }
 
+func (s *RedisStore) Ping(ctx context.Context) *pe.PinErr {
+	if _, err := s.DB.Ping().Result(); err != nil {
+		logging.WithFuncName().WithContext(ctx).WithError(err).Error("error pinging Redis")
+		return pe.ErrServiceFailure("error pinging Redis").WithCause(err)
+	}
+	return nil
+}
+
 func (s *RedisStore) Close() *pe.PinErr {
 	if err := s.DB.Close(); err != nil {
 		return pe.ErrServiceFailure("failed close Redis client").WithCause(err)
@@ -329,24 +612,44 @@ type FileStore interface {
 	// Ref returns the reference of file in file storage layer for future persistence and access. It should
 	// always be deterministic based on pin ID and filename
 	Ref(pinID, filename string) string
-	Save(ref string, r io.ReadCloser) *pe.PinErr
-	Get(ref string) (io.ReadCloser, *pe.PinErr)
+	Save(ctx context.Context, ref string, r io.ReadCloser) *pe.PinErr
+	Get(ctx context.Context, ref string) (io.ReadCloser, *pe.PinErr)
+	// Size returns the size of file in bytes. It returns an error of code ErrCodeNotFound if the file does not
+	// exist
+	Size(ctx context.Context, ref string) (int64, *pe.PinErr)
 	// Delete deletes pin attachments from store. Delete must be idempotent
-	Delete(ref string) *pe.PinErr
+	Delete(ctx context.Context, ref string) *pe.PinErr
+	// Walk calls fn with the pin ID, reference and modification time of every file in FileStore. It stops at the
+	// first error returned by fn
+	Walk(ctx context.Context, fn func(pinID, ref string, modTime time.Time) error) *pe.PinErr
+	// Ping checks whether FileStore is able to serve requests, including saving files
+	Ping(ctx context.Context) *pe.PinErr
 	Close() *pe.PinErr
 }
 
+// DefaultFileStoreRoot is the directory LocalFileStore keeps files under by default
+const DefaultFileStoreRoot = "/tmp"
+
 // LocalFileStore implements FileStore backed by local file system
 type LocalFileStore struct {
+	// Root is the directory to keep files under. It falls back to DefaultFileStoreRoot if empty
+	Root string
+}
+
+func (fs *LocalFileStore) root() string {
+	if fs.Root == "" {
+		return DefaultFileStoreRoot
+	}
+	return fs.Root
 }
 
 func (fs *LocalFileStore) Ref(pinID, filename string) string {
 	// TODO: this doesn't scale under high write traffic due to inode exhausation. Essentially local fs storage solution won't scale at all;
 	// leveraging third-party services like S3 if pins with attachments are really growing
-	return filepath.Join(string(filepath.Separator), "tmp", pinID, filename)
+	return filepath.Join(fs.root(), pinID, filename)
 }
 
-func (fs *LocalFileStore) Save(ref string, r io.ReadCloser) *pe.PinErr {
+func (fs *LocalFileStore) Save(ctx context.Context, ref string, r io.ReadCloser) *pe.PinErr {
 	pinAttachmentMaxSizeByte := viper.GetInt64(cst.EnvPinAttachmentSizeMaxByte)
 	// 1. prepare file to host data
 	errMsg := "error allocating file storage space"
@@ -370,7 +673,7 @@ func (fs *LocalFileStore) Save(ref string, r io.ReadCloser) *pe.PinErr {
 	return nil
 }
 
-func (fs *LocalFileStore) Get(ref string) (io.ReadCloser, *pe.PinErr) {
+func (fs *LocalFileStore) Get(ctx context.Context, ref string) (io.ReadCloser, *pe.PinErr) {
 	f, err := os.Open(ref)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -381,10 +684,85 @@ func (fs *LocalFileStore) Get(ref string) (io.ReadCloser, *pe.PinErr) {
 	return f, nil
 }
 
-func (fs *LocalFileStore) Delete(ref string) *pe.PinErr {
+func (fs *LocalFileStore) Size(ctx context.Context, ref string) (int64, *pe.PinErr) {
+	fi, err := os.Stat(ref)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, pe.ErrNotFound("pin attachment not found").WithCause(err)
+		}
+		return 0, pe.ErrServiceFailure("error getting pin attachment size").WithCause(err)
+	}
+	return fi.Size(), nil
+}
+
+func (fs *LocalFileStore) Delete(ctx context.Context, ref string) *pe.PinErr {
 	if err := os.Remove(ref); err != nil && !os.IsNotExist(err) {
 		return pe.ErrServiceFailure("error removing pin attachment").WithCause(err)
 	}
+	// remove the pin's directory along with its last attachment in best-effort manner; os.Remove fails on
+	// non-empty directories
+	if dir := filepath.Dir(ref); dir != filepath.Clean(fs.root()) {
+		os.Remove(dir)
+	}
+	return nil
+}
+
+// Walk visits files in directories named after pin IDs under root only, since root may be shared with others,
+// e.g. /tmp. Still, it is advised to dedicate a directory to LocalFileStore
+func (fs *LocalFileStore) Walk(ctx context.Context, fn func(pinID, ref string, modTime time.Time) error) *pe.PinErr {
+	const errMsg = "error walking file store"
+	root := fs.root()
+	dirs, err := ioutil.ReadDir(root)
+	if err != nil {
+		return pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	for _, dir := range dirs {
+		if !dir.IsDir() || !pinid.Valid(dir.Name()) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return pe.ErrServiceFailure(errMsg).WithCause(err)
+		}
+		pinDir := filepath.Join(root, dir.Name())
+		files, err := ioutil.ReadDir(pinDir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				// removed along with its last attachment meanwhile
+				continue
+			}
+			return pe.ErrServiceFailure(errMsg).WithCause(err)
+		}
+		for _, f := range files {
+			if f.IsDir() {
+				continue
+			}
+			if err := fn(dir.Name(), filepath.Join(pinDir, f.Name()), f.ModTime()); err != nil {
+				return pe.ErrServiceFailure(errMsg).WithCause(err)
+			}
+		}
+	}
+	return nil
+}
+
+// Ping verifies the root directory is writable by writing and removing a probe file in it
+func (fs *LocalFileStore) Ping(ctx context.Context) *pe.PinErr {
+	const errMsg = "file store root is not writable"
+	f, err := ioutil.TempFile(fs.root(), ".ping")
+	if err != nil {
+		return pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	name := f.Name()
+	_, werr := f.Write([]byte("ping"))
+	cerr := f.Close()
+	if err := os.Remove(name); err != nil {
+		return pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	if werr != nil {
+		return pe.ErrServiceFailure(errMsg).WithCause(werr)
+	}
+	if cerr != nil {
+		return pe.ErrServiceFailure(errMsg).WithCause(cerr)
+	}
 	return nil
 }
 
@@ -0,0 +1,317 @@
+package stores
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	pe "wuyrush.io/pin/errors"
+	md "wuyrush.io/pin/models"
+)
+
+// testPinStoreContract checks the behavior PinStore documents against stores made by newStore, each of which
+// backs a single subtest and is closed by it
+func testPinStoreContract(t *testing.T, newStore func() PinStore) {
+	ctx := context.Background()
+	// save registers and saves pins the way server does
+	save := func(t *testing.T, s PinStore, ps ...*md.Pin) {
+		for _, p := range ps {
+			if err := s.Register(ctx, p); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Save(ctx, p); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	t.Run("get", func(t *testing.T) {
+		s := newStore()
+		defer s.Close()
+		now := time.Now()
+		live := &md.Pin{ID: "live", OwnerID: "alice", Mode: md.AccessModePrivate, CreationTime: now,
+			GoodFor: time.Hour, Title: "title", Note: "note", Attachments: map[string]string{"a.txt": "live/a.txt"}}
+		stale := &md.Pin{ID: "stale", CreationTime: now.Add(-2 * time.Hour), GoodFor: time.Hour}
+		save(t, s, live, stale)
+		if err := s.Register(ctx, live); err == nil || err.Code != pe.ErrCodeConflict {
+			t.Errorf("expected conflict registering pin twice, got %v", err)
+		}
+		p, err := s.Get(ctx, live.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.OwnerID != "alice" || p.Mode != md.AccessModePrivate || p.Title != "title" || p.Note != "note" ||
+			!p.CreationTime.Equal(live.CreationTime) || p.GoodFor != time.Hour || p.Attachments["a.txt"] != "live/a.txt" {
+			t.Errorf("expected pin saved as is, got %+v", p)
+		}
+		if _, err := s.Get(ctx, stale.ID); err == nil || err.Code != pe.ErrCodeNotFound {
+			t.Errorf("expected stale pin not found, got %v", err)
+		}
+		if err := s.Delete(ctx, live.ID); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Delete(ctx, live.ID); err != nil {
+			t.Errorf("expected deleting pin twice to succeed, got %v", err)
+		}
+		if _, err := s.Get(ctx, live.ID); err == nil || err.Code != pe.ErrCodeNotFound {
+			t.Errorf("expected deleted pin not found, got %v", err)
+		}
+	})
+	t.Run("view", func(t *testing.T) {
+		s := newStore()
+		defer s.Close()
+		p := &md.Pin{ID: "p", CreationTime: time.Now(), GoodFor: time.Hour}
+		save(t, s, p)
+		for i := uint64(1); i <= 2; i++ {
+			v, err := s.View(ctx, p.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v.ViewCount != i {
+				t.Errorf("expected view count %d, got %d", i, v.ViewCount)
+			}
+		}
+		if _, err := s.View(ctx, "missing"); err == nil || err.Code != pe.ErrCodeNotFound {
+			t.Errorf("expected missing pin not found, got %v", err)
+		}
+	})
+	t.Run("burn", func(t *testing.T) {
+		defer func(g time.Duration) { burnGrace = g }(burnGrace)
+		burnGrace = 50 * time.Millisecond
+		s := newStore()
+		defer s.Close()
+		p := &md.Pin{ID: "p", OwnerID: "alice", CreationTime: time.Now(), GoodFor: time.Hour, ReadAndBurn: true,
+			Attachments: map[string]string{"a.txt": "p/a.txt"}}
+		save(t, s, p)
+		v, err := s.View(ctx, p.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.ViewCount != 1 || v.Attachments["a.txt"] != "p/a.txt" {
+			t.Errorf("expected pin viewed once with its attachment, got %+v", v)
+		}
+		if _, err := s.View(ctx, p.ID); err == nil || err.Code != pe.ErrCodeNotFound {
+			t.Errorf("expected burnt pin not to be viewed again, got %v", err)
+		}
+		if _, err := s.Extend(ctx, p, time.Hour, 24*time.Hour); err == nil || err.Code != pe.ErrCodeNotFound {
+			t.Errorf("expected burnt pin not to be extended, got %v", err)
+		}
+		// follow-up requests of the viewer find the pin during its grace period
+		if _, err := s.Get(ctx, p.ID); err != nil {
+			t.Errorf("expected burnt pin during its grace period, got %v", err)
+		}
+		if n, _ := s.JunkCount(ctx); n != 0 {
+			t.Errorf("expected burnt pin not junk during its grace period, got %d junk pins", n)
+		}
+		time.Sleep(burnGrace)
+		if _, err := s.Get(ctx, p.ID); err == nil || err.Code != pe.ErrCodeNotFound {
+			t.Errorf("expected burnt pin gone after its grace period, got %v", err)
+		}
+		jks, err := s.Junk(ctx, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(jks) != 1 || jks[0].PinID != p.ID || jks[0].OwnerID != "alice" || len(jks[0].FileRefs) != 1 {
+			t.Errorf("expected burnt pin as junk after its grace period, got %+v", jks)
+		}
+	})
+	t.Run("extend", func(t *testing.T) {
+		s := newStore()
+		defer s.Close()
+		now := time.Now()
+		p := &md.Pin{ID: "p", CreationTime: now.Add(-time.Hour), GoodFor: time.Hour + 200*time.Millisecond}
+		save(t, s, p)
+		// concurrent extensions add up
+		var wg sync.WaitGroup
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := s.Extend(ctx, p, 30*time.Minute, 3*time.Hour); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+		// both pin data and its registration outlive the original expiry
+		time.Sleep(250 * time.Millisecond)
+		want := 2*time.Hour + 200*time.Millisecond
+		if e, err := s.Get(ctx, p.ID); err != nil || e.GoodFor != want {
+			t.Errorf("expected pin extended to %s, got %+v, %v", want, e, err)
+		}
+		if _, err := s.Extend(ctx, p, time.Hour, 3*time.Hour); err == nil || err.Code != pe.ErrCodeAPIBadRequest {
+			t.Errorf("expected extension beyond cap rejected, got %v", err)
+		}
+		if goodFor, err := s.Extend(ctx, p, 30*time.Minute, 3*time.Hour); err != nil || goodFor != want+30*time.Minute {
+			t.Errorf("expected extended good-for period returned, got %s, %v", goodFor, err)
+		}
+		if n, _ := s.JunkCount(ctx); n != 0 {
+			t.Errorf("expected pin registration extended, got %d junk pins", n)
+		}
+		stale := &md.Pin{ID: "stale", CreationTime: now.Add(-2 * time.Hour), GoodFor: time.Hour}
+		save(t, s, stale)
+		if _, err := s.Extend(ctx, stale, 2*time.Hour, 24*time.Hour); err == nil || err.Code != pe.ErrCodeNotFound {
+			t.Errorf("expected stale pin not to be extended, got %v", err)
+		}
+	})
+	t.Run("junk", func(t *testing.T) {
+		s := newStore()
+		defer s.Close()
+		now := time.Now()
+		live := &md.Pin{ID: "live", CreationTime: now, GoodFor: time.Hour}
+		stale := &md.Pin{ID: "stale", OwnerID: "alice", CreationTime: now.Add(-2 * time.Hour), GoodFor: time.Hour,
+			Attachments: map[string]string{"a.txt": "stale/a.txt"}}
+		staler := &md.Pin{ID: "staler", CreationTime: now.Add(-3 * time.Hour), GoodFor: time.Hour}
+		save(t, s, live, stale, staler)
+		if n, _ := s.JunkCount(ctx); n != 2 {
+			t.Errorf("expected 2 junk pins, got %d", n)
+		}
+		jks, err := s.Junk(ctx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(jks) != 1 || jks[0].PinID != staler.ID {
+			t.Fatalf("expected the stalest pin as junk, got %+v", jks)
+		}
+		if err := s.Deregister(ctx, staler.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Refs(ctx, staler.ID); err == nil || err.Code != pe.ErrCodeNotFound {
+			t.Errorf("expected deregistered pin not found, got %v", err)
+		}
+		jks, _ = s.Junk(ctx, 0)
+		if len(jks) != 1 || jks[0].PinID != stale.ID || jks[0].OwnerID != "alice" ||
+			!jks[0].Expiry.Equal(stale.CreationTime.Add(stale.GoodFor)) || len(jks[0].FileRefs) != 1 ||
+			jks[0].FileRefs[0] != "stale/a.txt" {
+			t.Errorf("expected stale pin as the only junk, got %+v", jks)
+		}
+		if refs, err := s.Refs(ctx, stale.ID); err != nil || len(refs) != 1 || refs[0] != "stale/a.txt" {
+			t.Errorf("expected references of stale pin, got %v, %v", refs, err)
+		}
+		if _, err := s.Junk(ctx, -1); err == nil || err.Code != pe.ErrCodeAPIBadRequest {
+			t.Errorf("expected negative max item count rejected, got %v", err)
+		}
+	})
+	t.Run("lease", func(t *testing.T) {
+		s := newStore()
+		defer s.Close()
+		if ok, err := s.Claim(ctx, "p", "d1", time.Minute); err != nil || !ok {
+			t.Fatalf("expected claim to succeed, got %v, %v", ok, err)
+		}
+		if ok, err := s.Claim(ctx, "p", "d2", time.Minute); err != nil || ok {
+			t.Errorf("expected claim of claimed pin to fail, got %v, %v", ok, err)
+		}
+		if ok, _ := s.Renew(ctx, "p", "d1", time.Minute); !ok {
+			t.Error("expected holder to renew lease")
+		}
+		if ok, _ := s.Renew(ctx, "p", "d2", time.Minute); ok {
+			t.Error("expected others not to renew lease")
+		}
+		if err := s.Release(ctx, "p", "d2"); err != nil {
+			t.Fatal(err)
+		}
+		if ok, _ := s.Claim(ctx, "p", "d2", time.Minute); ok {
+			t.Error("expected others not to release lease")
+		}
+		if err := s.Release(ctx, "p", "d1"); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Release(ctx, "p", "d1"); err != nil {
+			t.Errorf("expected releasing lease twice to succeed, got %v", err)
+		}
+		if ok, _ := s.Renew(ctx, "p", "d1", time.Minute); ok {
+			t.Error("expected released lease not to be renewed")
+		}
+		if ok, _ := s.Claim(ctx, "p", "d2", time.Minute); !ok {
+			t.Error("expected claim of released pin to succeed")
+		}
+		// leases of crashed holders run out
+		if ok, _ := s.Claim(ctx, "q", "d1", 10*time.Millisecond); !ok {
+			t.Fatal("expected claim to succeed")
+		}
+		time.Sleep(20 * time.Millisecond)
+		if ok, _ := s.Claim(ctx, "q", "d2", time.Minute); !ok {
+			t.Error("expected claim of pin with lease run out to succeed")
+		}
+	})
+	t.Run("failure", func(t *testing.T) {
+		s := newStore()
+		defer s.Close()
+		now := time.Now()
+		p := &md.Pin{ID: "p", CreationTime: now.Add(-2 * time.Hour), GoodFor: time.Hour}
+		q := &md.Pin{ID: "q", CreationTime: now.Add(-3 * time.Hour), GoodFor: time.Hour}
+		save(t, s, p, q)
+		expiry := p.CreationTime.Add(p.GoodFor)
+		// failed pins are not junk till their retry time, after which they keep their expiry
+		f := &md.JunkFailure{PinID: p.ID, Attempts: 1, LastErr: "boom", LastAttempt: now, Expiry: expiry}
+		if err := s.Fail(ctx, f, now.Add(time.Hour), false); err != nil {
+			t.Fatal(err)
+		}
+		if jks, _ := s.Junk(ctx, 0); len(jks) != 1 || jks[0].PinID != q.ID {
+			t.Errorf("expected pin not junk during backoff, got %+v", jks)
+		}
+		if err := s.Fail(ctx, f, now, false); err != nil {
+			t.Fatal(err)
+		}
+		jks, err := s.Junk(ctx, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(jks) != 2 || jks[1].PinID != p.ID || jks[1].Attempts != 1 || !jks[1].Expiry.Equal(expiry) {
+			t.Fatalf("expected retried pin as junk with its attempts and expiry, got %+v", jks)
+		}
+		// quarantined pins are no longer junk, yet stay registered
+		f.Attempts = 2
+		if err := s.Fail(ctx, f, now, true); err != nil {
+			t.Fatal(err)
+		}
+		g := &md.JunkFailure{PinID: q.ID, Attempts: 1, LastErr: "bang", LastAttempt: now.Add(-time.Minute),
+			Expiry: q.CreationTime.Add(q.GoodFor)}
+		if err := s.Fail(ctx, g, now, true); err != nil {
+			t.Fatal(err)
+		}
+		if n, _ := s.JunkCount(ctx); n != 0 {
+			t.Errorf("expected quarantined pins not junk, got %d junk pins", n)
+		}
+		if err := s.Register(ctx, p); err == nil || err.Code != pe.ErrCodeConflict {
+			t.Errorf("expected conflict registering quarantined pin, got %v", err)
+		}
+		fs, err := s.Quarantined(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(fs) != 2 || fs[0].PinID != q.ID || fs[1].PinID != p.ID || fs[1].Attempts != 2 || fs[1].LastErr != "boom" {
+			t.Fatalf("expected quarantined pins in order of quarantine time, got %+v", fs)
+		}
+		// requeued pins are junk again with their attempts forgotten
+		if err := s.Requeue(ctx, p.ID); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Requeue(ctx, p.ID); err == nil || err.Code != pe.ErrCodeNotFound {
+			t.Errorf("expected requeuing pin not quarantined to fail, got %v", err)
+		}
+		if jks, _ := s.Junk(ctx, 0); len(jks) != 1 || jks[0].PinID != p.ID || jks[0].Attempts != 0 {
+			t.Errorf("expected requeued pin as junk with attempts forgotten, got %+v", jks)
+		}
+		// discarded pins are deregistered
+		if err := s.Discard(ctx, p.ID); err == nil || err.Code != pe.ErrCodeNotFound {
+			t.Errorf("expected discarding pin not quarantined to fail, got %v", err)
+		}
+		if err := s.Discard(ctx, q.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Refs(ctx, q.ID); err == nil || err.Code != pe.ErrCodeNotFound {
+			t.Errorf("expected discarded pin not registered, got %v", err)
+		}
+		if fs, _ := s.Quarantined(ctx); len(fs) != 0 {
+			t.Errorf("expected no quarantined pin, got %+v", fs)
+		}
+	})
+	t.Run("ping", func(t *testing.T) {
+		s := newStore()
+		defer s.Close()
+		if err := s.Ping(ctx); err != nil {
+			t.Error(err)
+		}
+	})
+}
@@ -0,0 +1,97 @@
+package stores
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/segmentio/ksuid"
+
+	"wuyrush.io/pin/common/logging"
+	pe "wuyrush.io/pin/errors"
+)
+
+// Throttler vends primitives to throttle operations across server replicas.
+type Throttler interface {
+	// Acquire claims key for the given period and reports whether the claim succeeds, aka nobody else had
+	// claimed key in the period
+	Acquire(ctx context.Context, key string, period time.Duration) (bool, *pe.PinErr)
+	// Allow reports whether one more hit on key is allowed, given at most limit hits in any sliding window of
+	// the given size. Allowed hits count towards the limit. If the hit is not allowed, Allow also returns how
+	// long to wait till the next hit is allowed
+	Allow(ctx context.Context, key string, limit int, window time.Duration) (bool, time.Duration, *pe.PinErr)
+	// Count adds delta to the counter of key in the current fixed window of the given size, and returns the
+	// resulting count. Counters reset at the end of their windows
+	Count(ctx context.Context, key string, delta int64, window time.Duration) (int64, *pe.PinErr)
+}
+
+// prefix of Redis keys used by Throttler
+const keyPrefixThrottle = "throttle."
+
+func (s *RedisStore) Acquire(ctx context.Context, key string, period time.Duration) (bool, *pe.PinErr) {
+	ok, err := s.DB.SetNX(keyPrefixThrottle+key, 1, period).Result()
+	if err != nil {
+		logging.WithFuncName().WithContext(ctx).WithError(err).WithField("key", key).Error("error calling Redis to acquire key")
+		return false, pe.ErrServiceFailure("error acquiring throttle key").WithCause(err)
+	}
+	return ok, nil
+}
+
+// scriptAllow implements sliding window log with a sorted set, whose members are hits scored by their time.
+// KEYS: window key
+// ARGV: current time in unix milliseconds, window size in milliseconds, limit, unique member of the hit
+// returns 0 if the hit is allowed, otherwise milliseconds to wait till the next hit is allowed
+var scriptAllow = redis.NewScript(`
+local now, window, limit = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3])
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now - window)
+if redis.call("ZCARD", KEYS[1]) < limit then
+	redis.call("ZADD", KEYS[1], now, ARGV[4])
+	redis.call("PEXPIRE", KEYS[1], window)
+	return 0
+end
+local oldest = redis.call("ZRANGE", KEYS[1], 0, 0, "WITHSCORES")
+return math.max(tonumber(oldest[2]) + window - now, 1)
+`)
+
+func (s *RedisStore) Allow(ctx context.Context, key string, limit int, window time.Duration) (bool, time.Duration, *pe.PinErr) {
+	clog := logging.WithFuncName().WithContext(ctx).WithField("key", key)
+	if limit <= 0 || window <= 0 {
+		return false, 0, pe.ErrBadInput("rate limit and window size must be positive")
+	}
+	member, err := ksuid.NewRandom()
+	if err != nil {
+		clog.WithError(err).Error("error generating hit id")
+		return false, 0, pe.ErrServiceFailure("error rate limiting").WithCause(err)
+	}
+	ms := int64(time.Millisecond)
+	wait, err := scriptAllow.Run(s.DB, []string{keyPrefixThrottle + key},
+		time.Now().UnixNano()/ms, int64(window)/ms, limit, member.String()).Int64()
+	if err != nil {
+		clog.WithError(err).Error("error calling Redis to rate limit")
+		return false, 0, pe.ErrServiceFailure("error rate limiting").WithCause(err)
+	}
+	if wait > 0 {
+		return false, time.Duration(wait) * time.Millisecond, nil
+	}
+	return true, 0, nil
+}
+
+// scriptCount implements fixed window counter, whose window starts upon the first count.
+// KEYS: counter key
+// ARGV: delta, window size in milliseconds
+var scriptCount = redis.NewScript(`
+local n = redis.call("INCRBY", KEYS[1], ARGV[1])
+if redis.call("PTTL", KEYS[1]) < 0 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return n
+`)
+
+func (s *RedisStore) Count(ctx context.Context, key string, delta int64, window time.Duration) (int64, *pe.PinErr) {
+	n, err := scriptCount.Run(s.DB, []string{keyPrefixThrottle + key}, delta, int64(window/time.Millisecond)).Int64()
+	if err != nil {
+		logging.WithFuncName().WithContext(ctx).WithError(err).WithField("key", key).Error("error calling Redis to count")
+		return 0, pe.ErrServiceFailure("error counting").WithCause(err)
+	}
+	return n, nil
+}
@@ -0,0 +1,80 @@
+package stores
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis"
+
+	"wuyrush.io/pin/common/logging"
+	pe "wuyrush.io/pin/errors"
+	md "wuyrush.io/pin/models"
+)
+
+// TokenStore vends the interface to manage API tokens of users. Tokens are stored in hashed form only.
+type TokenStore interface {
+	SaveToken(ctx context.Context, token string, u *md.User) *pe.PinErr
+	// UserByToken returns the user owning the given token. It returns an error of code ErrCodeNotFound if the
+	// token is unknown
+	UserByToken(ctx context.Context, token string) (*md.User, *pe.PinErr)
+	// RevokeToken removes the given token. RevokeToken must be idempotent
+	RevokeToken(ctx context.Context, token string) *pe.PinErr
+}
+
+// template to form an unique identifier for an API token
+const keyTmplToken = `token.%s`
+
+func (s *RedisStore) SaveToken(ctx context.Context, token string, u *md.User) *pe.PinErr {
+	const errMsg = "error saving API token"
+	clog := logging.WithFuncName().WithContext(ctx).WithField("userID", u.ID)
+	b, err := json.Marshal(u)
+	if err != nil {
+		clog.WithError(err).Error("error marshalling token owner to JSON")
+		return pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	if _, err := s.DB.Set(s.tokenKey(token), b, time.Duration(0)).Result(); err != nil {
+		clog.WithError(err).Error("error calling Redis to save API token")
+		return pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	return nil
+}
+
+func (s *RedisStore) UserByToken(ctx context.Context, token string) (*md.User, *pe.PinErr) {
+	const errMsg = "error looking up API token"
+	clog := logging.WithFuncName().WithContext(ctx)
+	v, err := s.DB.Get(s.tokenKey(token)).Result()
+	if err == redis.Nil {
+		return nil, pe.ErrNotFound("unknown API token")
+	} else if err != nil {
+		clog.WithError(err).Error("error calling Redis to look up API token")
+		return nil, pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	u := &md.User{}
+	if err := json.Unmarshal([]byte(v), u); err != nil {
+		clog.WithError(err).Error("error unmarshalling token owner")
+		return nil, pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	return u, nil
+}
+
+func (s *RedisStore) RevokeToken(ctx context.Context, token string) *pe.PinErr {
+	if _, err := s.DB.Del(s.tokenKey(token)).Result(); err != nil {
+		logging.WithFuncName().WithContext(ctx).WithError(err).Error("error calling Redis to revoke API token")
+		return pe.ErrServiceFailure("error revoking API token").WithCause(err)
+	}
+	return nil
+}
+
+func (s *RedisStore) tokenKey(token string) string {
+	return fmt.Sprintf(keyTmplToken, hashToken(token))
+}
+
+// hashToken returns the hashed form of token to store
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
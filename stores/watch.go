@@ -0,0 +1,97 @@
+package stores
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+
+	"wuyrush.io/pin/common/logging"
+	"wuyrush.io/pin/common/pinid"
+	pe "wuyrush.io/pin/errors"
+	md "wuyrush.io/pin/models"
+)
+
+// JunkWatcher watches pins turning into junk, so that they can be disposed of as soon as they expire instead of
+// upon the next sweep. Burnt pins turn into junk once their grace period ends.
+type JunkWatcher interface {
+	// Watch streams junk pins as they turn into junk till ctx is cancelled, upon which the returned channel
+	// is closed. Pins turning into junk while the watcher is disconnected are missed, hence callers shall keep
+	// sweeping junk pins as a safety net
+	Watch(ctx context.Context) (<-chan *md.Junk, *pe.PinErr)
+}
+
+// Watch subscribes to expired key events of Redis, which requires keyspace notifications of class Ex enabled on
+// Redis server
+func (s *RedisStore) Watch(ctx context.Context) (<-chan *md.Junk, *pe.PinErr) {
+	clog := logging.WithFuncName().WithContext(ctx)
+	channelExpired := fmt.Sprintf("__keyevent@%d__:expired", s.DB.Options().DB)
+	sub := s.DB.Subscribe(channelExpired)
+	// wait for confirmation of the subscription so that failures surface early
+	if _, err := sub.Receive(); err != nil {
+		sub.Close()
+		clog.WithError(err).Error("error subscribing to Redis channel")
+		return nil, pe.ErrServiceFailure("error watching junk pins").WithCause(err)
+	}
+	// CONFIG may be disabled on managed Redis, hence the check is best-effort
+	if v, err := s.DB.ConfigGet("notify-keyspace-events").Result(); err == nil && len(v) == 2 {
+		if flags, _ := v[1].(string); !strings.Contains(flags, "E") || !strings.ContainsAny(flags, "xA") {
+			clog.WithField("notifyKeyspaceEvents", flags).Warn("Redis does not notify of expired key events. Expired pins are left to sweeps")
+		}
+	}
+	jkChan := make(chan *md.Junk)
+	go func() {
+		defer close(jkChan)
+		defer sub.Close()
+		// the subscription reconnects on its own upon network errors
+		msgs := sub.Channel()
+		for {
+			select {
+			case msg, ok := <-msgs:
+				if !ok {
+					return
+				}
+				// expired key events carry keys of all sorts, of which pin data is keyed by pin ID
+				if !pinid.Valid(msg.Payload) {
+					continue
+				}
+				jk := s.junkPin(ctx, msg.Payload)
+				if jk == nil {
+					continue
+				}
+				select {
+				case jkChan <- jk:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return jkChan, nil
+}
+
+// junkPin assembles the junk pin of the given ID. It returns nil if the pin is not junk, e.g. it had been
+// deregistered, quarantined or re-scored for deletion retry, or assembling fails
+func (s *RedisStore) junkPin(ctx context.Context, pinID string) *md.Junk {
+	clog := logging.WithFuncName().WithContext(ctx).WithField("pinID", pinID)
+	score, err := s.DB.ZScore(keyPinExpirySet, pinID).Result()
+	if err == redis.Nil {
+		return nil
+	}
+	if err != nil {
+		clog.WithError(err).Error("error calling Redis to get pin expiry from index")
+		return nil
+	}
+	if int64(score) > time.Now().Unix() {
+		return nil
+	}
+	jks, err := s.junk(ctx, []redis.Z{{Score: score, Member: pinID}})
+	if err != nil || len(jks) == 0 {
+		return nil
+	}
+	return jks[0]
+}
@@ -0,0 +1,137 @@
+package stores
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-redis/redis"
+	log "github.com/sirupsen/logrus"
+
+	"wuyrush.io/pin/common/logging"
+	pe "wuyrush.io/pin/errors"
+	md "wuyrush.io/pin/models"
+)
+
+// WebhookStore vends the interface to manage user webhooks along with their delivery logs.
+type WebhookStore interface {
+	SaveWebhook(ctx context.Context, h *md.Webhook) *pe.PinErr
+	// Webhooks returns all webhooks registered by the given user
+	Webhooks(ctx context.Context, ownerID string) ([]*md.Webhook, *pe.PinErr)
+	// DeleteWebhook removes webhook along with its delivery log. DeleteWebhook must be idempotent
+	DeleteWebhook(ctx context.Context, ownerID, hookID string) *pe.PinErr
+	// LogDelivery appends d to the delivery log of its webhook. The log keeps the latest maxDeliveryLogSize
+	// deliveries only
+	LogDelivery(ctx context.Context, d *md.Delivery) *pe.PinErr
+	// Deliveries returns up to max latest deliveries of the given webhook, latest first. It returns the whole
+	// log when max == 0
+	Deliveries(ctx context.Context, hookID string, max int) ([]*md.Delivery, *pe.PinErr)
+}
+
+const (
+	maxDeliveryLogSize = 100
+	// template to form an unique identifier for the hash of webhooks registered by an user
+	keyTmplWebhooks = `webhooks.%s`
+	// template to form an unique identifier for the delivery log of a webhook
+	keyTmplDeliveries = `deliveries.%s`
+)
+
+func (s *RedisStore) SaveWebhook(ctx context.Context, h *md.Webhook) *pe.PinErr {
+	const errMsg = "error saving webhook"
+	clog := logging.WithFuncName().WithContext(ctx).WithField("hookID", h.ID)
+	b, err := json.Marshal(h)
+	if err != nil {
+		clog.WithError(err).Error("error marshalling webhook to JSON")
+		return pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	if _, err := s.DB.HSet(s.webhooksKey(h.OwnerID), h.ID, b).Result(); err != nil {
+		clog.WithError(err).Error("error calling Redis to save webhook")
+		return pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	return nil
+}
+
+func (s *RedisStore) Webhooks(ctx context.Context, ownerID string) ([]*md.Webhook, *pe.PinErr) {
+	const errMsg = "error loading webhooks"
+	clog := logging.WithFuncName().WithContext(ctx).WithField("ownerID", ownerID)
+	m, err := s.DB.HGetAll(s.webhooksKey(ownerID)).Result()
+	if err != nil {
+		clog.WithError(err).Error("error calling Redis to load webhooks")
+		return nil, pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	hooks := make([]*md.Webhook, 0, len(m))
+	for id, v := range m {
+		h := &md.Webhook{}
+		if err := json.Unmarshal([]byte(v), h); err != nil {
+			clog.WithError(err).WithField("hookID", id).Error("error unmarshalling webhook")
+			return nil, pe.ErrServiceFailure(errMsg).WithCause(err)
+		}
+		hooks = append(hooks, h)
+	}
+	return hooks, nil
+}
+
+func (s *RedisStore) DeleteWebhook(ctx context.Context, ownerID, hookID string) *pe.PinErr {
+	const errMsg = "error deleting webhook"
+	clog := logging.WithFuncName().WithContext(ctx).WithField("hookID", hookID)
+	if _, err := s.DB.HDel(s.webhooksKey(ownerID), hookID).Result(); err != nil {
+		clog.WithError(err).Error("error calling Redis to delete webhook")
+		return pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	if _, err := s.DB.Del(s.deliveriesKey(hookID)).Result(); err != nil {
+		clog.WithError(err).Error("error calling Redis to delete webhook delivery log")
+		return pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	return nil
+}
+
+func (s *RedisStore) LogDelivery(ctx context.Context, d *md.Delivery) *pe.PinErr {
+	const errMsg = "error logging webhook delivery"
+	clog := logging.WithFuncName().WithContext(ctx).WithFields(log.Fields{"hookID": d.HookID, "deliveryID": d.ID})
+	b, err := json.Marshal(d)
+	if err != nil {
+		clog.WithError(err).Error("error marshalling webhook delivery to JSON")
+		return pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	key := s.deliveriesKey(d.HookID)
+	if _, err := s.DB.Pipelined(func(pipe redis.Pipeliner) error {
+		pipe.LPush(key, b)
+		pipe.LTrim(key, 0, maxDeliveryLogSize-1)
+		return nil
+	}); err != nil {
+		clog.WithError(err).Error("error calling Redis to log webhook delivery")
+		return pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	return nil
+}
+
+func (s *RedisStore) Deliveries(ctx context.Context, hookID string, max int) ([]*md.Delivery, *pe.PinErr) {
+	const errMsg = "error loading webhook deliveries"
+	clog := logging.WithFuncName().WithContext(ctx).WithField("hookID", hookID)
+	if max < 0 {
+		return nil, pe.ErrBadInput(fmt.Sprintf("got negative max item count %d", max))
+	}
+	vals, err := s.DB.LRange(s.deliveriesKey(hookID), 0, int64(max)-1).Result()
+	if err != nil {
+		clog.WithError(err).Error("error calling Redis to load webhook deliveries")
+		return nil, pe.ErrServiceFailure(errMsg).WithCause(err)
+	}
+	ds := make([]*md.Delivery, 0, len(vals))
+	for _, v := range vals {
+		d := &md.Delivery{}
+		if err := json.Unmarshal([]byte(v), d); err != nil {
+			clog.WithError(err).Error("error unmarshalling webhook delivery")
+			return nil, pe.ErrServiceFailure(errMsg).WithCause(err)
+		}
+		ds = append(ds, d)
+	}
+	return ds, nil
+}
+
+func (s *RedisStore) webhooksKey(ownerID string) string {
+	return fmt.Sprintf(keyTmplWebhooks, ownerID)
+}
+
+func (s *RedisStore) deliveriesKey(hookID string) string {
+	return fmt.Sprintf(keyTmplDeliveries, hookID)
+}
@@ -0,0 +1,291 @@
+// Package webhook vends delivery of pin lifecycle events to webhooks registered by pin owners.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/segmentio/ksuid"
+	log "github.com/sirupsen/logrus"
+	"wuyrush.io/pin/common/logging"
+	rt "wuyrush.io/pin/common/retry"
+	pe "wuyrush.io/pin/errors"
+	md "wuyrush.io/pin/models"
+	st "wuyrush.io/pin/stores"
+)
+
+// pin lifecycle event types
+const (
+	EventPinCreated = "pin.created"
+	EventPinViewed  = "pin.viewed"
+	EventPinBurned  = "pin.burned"
+	// EventPinExpired fires once deleter sweeps pin data, which includes pins burned earlier
+	EventPinExpired = "pin.expired"
+)
+
+// Events holds all event types a webhook can subscribe to
+var Events = map[string]struct{}{
+	EventPinCreated: {},
+	EventPinViewed:  {},
+	EventPinBurned:  {},
+	EventPinExpired: {},
+}
+
+// headers of callback requests
+const (
+	HeaderEvent     = "X-Pin-Event"
+	HeaderDelivery  = "X-Pin-Delivery"
+	HeaderSignature = "X-Pin-Signature" // in format of sha256=<hex encoded HMAC-SHA256 of request body>
+)
+
+const (
+	secretSizeByte = 32
+	timeout        = 10 * time.Second
+	maxAttempts    = 5
+)
+
+// privateNets holds address blocks for private use, which webhooks must not point to
+var privateNets = mustParseCIDRs("10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10", "fc00::/7")
+
+// errForbiddenAddr is returned upon dialing addresses webhooks must not point to
+var errForbiddenAddr = errors.New("webhook must not point to private, loopback, link-local or unspecified address")
+
+// Event is the JSON payload of webhook callbacks
+type Event struct {
+	ID    string    `json:"id"`
+	Type  string    `json:"type"`
+	PinID string    `json:"pinId"`
+	Time  time.Time `json:"time"`
+}
+
+// NewWebhook validates the given webhook settings and returns a webhook with fresh ID and signing secret
+func NewWebhook(ownerID, rawurl string, events []string) (*md.Webhook, *pe.PinErr) {
+	u, err := url.Parse(rawurl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, pe.ErrBadInput(fmt.Sprintf("invalid webhook url %q", rawurl))
+	}
+	// resolve the host to fail fast; the addresses are checked again upon delivery in case DNS records change
+	ips, err := net.LookupIP(u.Hostname())
+	if err != nil {
+		return nil, pe.ErrBadInput(fmt.Sprintf("error resolving webhook host %q", u.Hostname())).WithCause(err)
+	}
+	for _, ip := range ips {
+		if !publicIP(ip) {
+			return nil, pe.ErrBadInput(fmt.Sprintf("webhook host %q resolves to forbidden address %s",
+				u.Hostname(), ip))
+		}
+	}
+	if len(events) == 0 {
+		return nil, pe.ErrBadInput("webhook subscribes to no event")
+	}
+	for _, e := range events {
+		if _, ok := Events[e]; !ok {
+			return nil, pe.ErrBadInput(fmt.Sprintf("unknown event type %q", e))
+		}
+	}
+	id, err := ksuid.NewRandom()
+	if err != nil {
+		return nil, pe.ErrServiceFailure("error generating webhook id").WithCause(err)
+	}
+	secret := make([]byte, secretSizeByte)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, pe.ErrServiceFailure("error generating webhook secret").WithCause(err)
+	}
+	return &md.Webhook{
+		ID:           id.String(),
+		OwnerID:      ownerID,
+		URL:          u.String(),
+		Secret:       hex.EncodeToString(secret),
+		Events:       events,
+		CreationTime: time.Now().UTC(),
+	}, nil
+}
+
+// publicIP tells whether ip is a public address, i.e. neither private, loopback, link-local nor unspecified
+func publicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsUnspecified() {
+		return false
+	}
+	for _, n := range privateNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// dialControl rejects connections to addresses which are not public. It guards deliveries against hosts
+// resolving to public addresses upon webhook creation and to internal ones afterwards
+func dialControl(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+		return errForbiddenAddr
+	}
+	return nil
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+// Sign returns the value of HeaderSignature for payload signed with secret
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Notifier dispatches pin lifecycle events to webhooks of pin owners in background. Failed deliveries are
+// retried with exponential backoff, and the outcome of every delivery is kept in delivery log of the webhook.
+type Notifier struct {
+	HS        st.WebhookStore
+	Client    *http.Client
+	RetryOpts []rt.RetryOption
+	wg        sync.WaitGroup
+}
+
+// NewNotifier returns a Notifier with default http client and retry strategy. The client dials public
+// addresses only and ignores proxy settings, so that webhooks cannot reach into internal network
+func NewNotifier(hs st.WebhookStore) *Notifier {
+	dialer := &net.Dialer{Timeout: timeout, Control: dialControl}
+	return &Notifier{
+		HS: hs,
+		Client: &http.Client{
+			Timeout:   timeout,
+			Transport: &http.Transport{DialContext: dialer.DialContext},
+		},
+		RetryOpts: []rt.RetryOption{
+			// Retry makes up to MaxAttempts+1 retries after the first attempt
+			rt.WithMaxAttempts(maxAttempts - 2),
+			rt.WithBaseDelay(time.Second),
+			rt.WithExp(2.0),
+			rt.WithJitter(0.1),
+			rt.WithMaxBackoff(time.Minute),
+			rt.WithRetryOn(isRetryable),
+		},
+	}
+}
+
+// Notify dispatches event of the given type about pin to webhooks of the pin owner. It returns immediately; pins
+// created in anonymous mode are ignored. Deliveries outlive ctx, which only lends its request ID to them
+func (n *Notifier) Notify(ctx context.Context, ownerID, event, pinID string) {
+	if ownerID == "" {
+		return
+	}
+	ctx = logging.NewContext(context.Background(), logging.RequestID(ctx))
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		clog := logging.WithFuncName().WithContext(ctx).WithFields(log.Fields{"event": event, "pinID": pinID})
+		hooks, err := n.HS.Webhooks(ctx, ownerID)
+		if err != nil {
+			clog.WithError(err).Error("error loading webhooks of pin owner")
+			return
+		}
+		for _, h := range hooks {
+			if !h.Subscribed(event) {
+				continue
+			}
+			n.wg.Add(1)
+			go func(h *md.Webhook) {
+				defer n.wg.Done()
+				n.deliver(ctx, h, event, pinID)
+			}(h)
+		}
+	}()
+}
+
+// Wait blocks till all the pending deliveries finish
+func (n *Notifier) Wait() {
+	n.wg.Wait()
+}
+
+func (n *Notifier) deliver(ctx context.Context, h *md.Webhook, event, pinID string) {
+	clog := logging.WithFuncName().WithContext(ctx).WithFields(log.Fields{"hookID": h.ID, "event": event, "pinID": pinID})
+	id, err := ksuid.NewRandom()
+	if err != nil {
+		clog.WithError(err).Error("error generating delivery id")
+		return
+	}
+	d := &md.Delivery{ID: id.String(), HookID: h.ID, Event: event, PinID: pinID, Time: time.Now().UTC()}
+	payload, err := json.Marshal(&Event{ID: d.ID, Type: event, PinID: pinID, Time: d.Time})
+	if err != nil {
+		clog.WithError(err).Error("error marshalling event to JSON")
+		return
+	}
+	sig := Sign(h.Secret, payload)
+	post := func() error {
+		d.Attempts++
+		d.StatusCode = 0
+		req, err := http.NewRequest(http.MethodPost, h.URL, bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(HeaderEvent, event)
+		req.Header.Set(HeaderDelivery, d.ID)
+		req.Header.Set(HeaderSignature, sig)
+		resp, err := n.Client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		d.StatusCode = resp.StatusCode
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return errStatus(resp.StatusCode)
+		}
+		return nil
+	}
+	if err := rt.Retry(post, n.RetryOpts...); err != nil {
+		clog.WithError(err).WithField("attempts", d.Attempts).Error("error delivering event to webhook")
+		d.Err = err.Error()
+	} else {
+		d.Succeeded = true
+	}
+	if err := n.HS.LogDelivery(ctx, d); err != nil {
+		clog.WithError(err).Error("error logging webhook delivery")
+	}
+}
+
+// errStatus is the error of callbacks rejected by webhook endpoint with the given status code
+type errStatus int
+
+func (e errStatus) Error() string {
+	return fmt.Sprintf("webhook endpoint responded with status code %d", int(e))
+}
+
+// isRetryable retries on transport errors other than forbidden addresses, throttling and server side errors
+func isRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if code, ok := err.(errStatus); ok {
+		return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+	}
+	return !errors.Is(err, errForbiddenAddr)
+}
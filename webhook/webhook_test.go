@@ -0,0 +1,62 @@
+package webhook
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	pe "wuyrush.io/pin/errors"
+)
+
+func TestNewWebhook(t *testing.T) {
+	events := []string{EventPinViewed}
+	tcs := []struct {
+		name string
+		url  string
+		ok   bool
+	}{
+		{name: "public", url: "https://203.0.113.7/hook", ok: true},
+		{name: "public ipv6", url: "https://[2001:db8::1]/hook", ok: true},
+		{name: "bad scheme", url: "ftp://203.0.113.7/hook"},
+		{name: "loopback", url: "http://127.0.0.1:8080/hook"},
+		{name: "localhost", url: "http://localhost/hook"},
+		{name: "loopback ipv6", url: "http://[::1]/hook"},
+		{name: "private", url: "http://10.1.2.3/hook"},
+		{name: "private ipv6", url: "http://[fd00::1]/hook"},
+		{name: "link-local", url: "http://169.254.169.254/latest/meta-data"},
+		{name: "unspecified", url: "http://0.0.0.0/hook"},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			h, err := NewWebhook("alice", tc.url, events)
+			if tc.ok && err != nil {
+				t.Errorf("expected webhook created but got %v", err)
+			} else if !tc.ok && (err == nil || err.Code != pe.ErrCodeAPIBadRequest) {
+				t.Errorf("expected webhook rejected as bad input but got %+v, %v", h, err)
+			}
+		})
+	}
+}
+
+func TestNotifierRefusesInternalAddress(t *testing.T) {
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+	}))
+	defer srv.Close()
+	// the listener is on loopback, as webhook hosts may resolve to upon delivery despite passing creation checks
+	n := NewNotifier(nil)
+	resp, err := n.Client.Post(srv.URL, "application/json", strings.NewReader("{}"))
+	if err == nil {
+		resp.Body.Close()
+		t.Fatal("expected delivery to loopback address refused")
+	}
+	if isRetryable(err) {
+		t.Errorf("expected refused delivery not retried, got %v", err)
+	}
+	if hits != 0 {
+		t.Errorf("expected no request reaching the endpoint, got %d", hits)
+	}
+}
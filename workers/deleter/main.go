@@ -2,32 +2,91 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"os/signal"
-	"sync"
 	"syscall"
 	"time"
 
-	"github.com/bluele/gcache"
 	"github.com/go-redis/redis"
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 	"wuyrush.io/pin/common/logging"
+	"wuyrush.io/pin/common/metrics"
 	rt "wuyrush.io/pin/common/retry"
 	cst "wuyrush.io/pin/constants"
+	"wuyrush.io/pin/deleter"
 	pe "wuyrush.io/pin/errors"
-	md "wuyrush.io/pin/models"
 	st "wuyrush.io/pin/stores"
+	"wuyrush.io/pin/webhook"
+)
+
+// command line flags to manage junk pins quarantined after repeated deletion failures. Deleter carries out the
+// requested operation and exits instead of sweeping
+var (
+	flagListQuarantine = flag.Bool("list-quarantine", false, "list quarantined junk pins in JSON lines and exit")
+	flagRetry          = flag.String("retry", "", "move the quarantined junk pin of the given ID back for deletion and exit")
+	flagDiscard        = flag.String("discard", "", "forget the quarantined junk pin of the given ID without deleting its attachments and exit")
+	flagReconcile      = flag.Bool("reconcile", false, "delete orphaned attachment files in FileStore and exit")
+	flagCheckTTL       = flag.Bool("check-ttl", false, "list IDs of pins without expiry in PinStore and exit")
+	flagRepairTTL      = flag.Bool("repair-ttl", false, "expire pins without expiry in PinStore at their expiry and exit")
+)
+
+// command line flags to run deleter by hand, e.g. from cron or incident runbooks
+var (
+	flagOnce   = flag.Bool("once", false, "sweep junk pins once, wait for their deletion and exit")
+	flagDryRun = flag.Bool("dry-run", false, "list junk pins and their attachments in JSON lines without deleting them and exit")
+	flagReport = flag.Bool("report", false, "write a JSON summary of the run upon exit")
+	// the report goes apart from junk pins listed in dry run, which are written to stdout
+	flagReportFile = flag.String("report-file", "", "write the report to the given file instead of stderr")
 )
 
 func main() {
+	flag.Parse()
 	if err := runDeleter(); err != nil {
 		log.WithError(err).Fatal("error running deleter")
 	}
 }
 
-func setupPinStore() (st.PinStore, error) {
+// setupPinStore sets up the PinStore backend selected by configuration, which defaults to Redis. The bbolt file is
+// locked by the server while it runs, hence deleter opens it only when the server is down, e.g. to manage
+// quarantined junk pins or reconcile attachments of a single-node deployment by hand
+func setupPinStore() (st.Store, error) {
+	switch b := viper.GetString(cst.EnvPinStore); b {
+	case "", st.BackendRedis:
+		s, err := setupRedisStore()
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	case st.BackendBolt:
+		s, err := st.NewBoltStore(viper.GetString(cst.EnvDataDir))
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	case st.BackendSQL:
+		s, err := st.OpenSQLStoreFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	default:
+		// memory is private to the server process, which runs deleter embedded instead
+		return nil, pe.ErrBadInput(fmt.Sprintf("%s %q is not shared with deleter. Set %s on server instead",
+			cst.EnvPinStore, b, cst.EnvEmbeddedDeleter))
+	}
+}
+
+func setupRedisStore() (*st.RedisStore, error) {
 	retryOpts := []rt.RetryOption{
 		rt.WithTimeout(3 * time.Second),
 		rt.WithBaseDelay(100 * time.Millisecond),
@@ -40,6 +99,7 @@ func setupPinStore() (st.PinStore, error) {
 		DB:         viper.GetInt(cst.EnvRedisDB),
 		MaxRetries: 3,
 	})
+	metrics.InstrumentRedis(redisClient)
 	// verify the client is up correctly
 	pingFn := func() error {
 		_, err := redisClient.Ping().Result()
@@ -52,18 +112,16 @@ func setupPinStore() (st.PinStore, error) {
 }
 
 func setupFileStore() (st.FileStore, error) {
-	return &st.LocalFileStore{}, nil
+	return &st.LocalFileStore{Root: viper.GetString(cst.EnvFileStoreRoot)}, nil
 }
 
-type deleter struct {
-	FS       st.FileStore
-	PS       st.PinStore
-	wipCache gcache.Cache
-}
+// files younger than this are left alone by reconciliation
+const defaultReconcileGrace = time.Hour
 
 func runDeleter() error {
 	viper.AutomaticEnv()
 	logging.SetupLog("PinDeleter")
+	metrics.RegisterDeleter()
 	// setup dependencies
 	clog := logging.WithFuncName()
 	ps, err := setupPinStore()
@@ -78,135 +136,187 @@ func runDeleter() error {
 		return err
 	}
 	defer fs.Close()
-	localCacheSize := viper.GetInt(cst.EnvPinDeleterLocalCacheSize)
-	wipCache := gcache.New(localCacheSize).LRU().Build()
-	d := &deleter{FS: fs, PS: ps, wipCache: wipCache}
-	return d.Run()
-}
-
-func (d *deleter) Run() *pe.PinErr {
-	clog := logging.WithFuncName()
-	freq := viper.GetDuration(cst.EnvDeleterSweepFreq)
-	if freq <= 0 {
-		clog.WithField("sweepFrequency", freq).Fatal("got non-positive deleter sweep frequency")
+	if ok, err := manageQuarantine(context.Background(), ps, os.Stdout); ok {
+		return err
 	}
-	execPoolSize := viper.GetInt(cst.EnvDeleterExecutorPoolSize)
-	if execPoolSize <= 0 {
-		clog.WithField("deleterExecutorPoolSize", execPoolSize).Fatal("got non-positive deleter executor pool size")
+	if *flagCheckTTL || *flagRepairTTL {
+		rs, ok := ps.(*st.RedisStore)
+		if !ok {
+			return pe.ErrBadInput("pin expiry is checked on Redis only, which expires pins on its own")
+		}
+		return checkTTL(context.Background(), rs, *flagRepairTTL, os.Stdout)
+	}
+	if *flagReconcile {
+		grace := viper.GetDuration(cst.EnvDeleterReconcileGrace)
+		if grace <= 0 {
+			grace = defaultReconcileGrace
+		}
+		return reconcile(context.Background(), ps, fs, grace)
+	}
+	d := deleter.New(ps, fs, webhook.NewNotifier(ps))
+	d.Once = *flagOnce
+	d.Rep = deleter.NewReport(*flagDryRun)
+	d.Measure = *flagReport
+	clog.WithField("deleterID", d.ID()).Info("deleter is starting up")
+	// runs by hand may share host with a long-running deleter, hence serve no status endpoints
+	manual := d.Once || *flagDryRun
+	if port := viper.GetString(cst.EnvDeleterPort); port != "" && !manual {
+		go serveStatus(d, fmt.Sprintf(":%s", port))
+	} else if !manual {
+		clog.Infof("%s not set. Status endpoints are disabled", cst.EnvDeleterPort)
 	}
-	quotas := make(chan struct{}, execPoolSize)
-	maxLoad := viper.GetInt(cst.EnvDeleterMaxSweepLoad)
-	loadTkr := time.NewTicker(freq)
 	// ensure the worker can be responsive to system signals
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGTERM)
-LoopRun:
-	for {
-		select {
-		case <-loadTkr.C:
-			jks, err := d.Load(maxLoad)
-			if err != nil {
-				clog.WithError(err).Error("error loading junk pins")
-				// TODO: terminate when dependencies are hard-down
-				return err
-			}
-			clog.WithField("count", len(jks)).Debug("junk pins loaded")
-			// dispatch junk to workers in pool for disposal
-			for _, jk := range jks {
-				go func(jk *md.Junk) {
-					quotas <- struct{}{}
-					defer func() { <-quotas }()
-					if err := d.Delete(jk); err != nil {
-						clog.WithError(err).WithField("junk", jk).Error("error deleting junk pin")
-					}
-					clog.WithField("junk", jk).Debug("successfully deleting junk pin")
-				}(jk)
-			}
-		case <-sigChan:
-			clog.Info("got termination signal from kernel. Stopping")
-			break LoopRun
+	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		sig := <-sigChan
+		clog.WithField("signal", sig).Info("got termination signal. Stopping")
+		cancel()
+	}()
+	var rerr *pe.PinErr
+	if *flagDryRun {
+		rerr = d.DryRun(ctx, os.Stdout)
+	} else {
+		rerr = d.Run(ctx)
+	}
+	if *flagReport {
+		if err := writeReport(d.Rep, *flagReportFile); err != nil {
+			clog.WithError(err).Error("error writing report")
 		}
 	}
+	// avoid returning a non-nil error interface holding a nil *pe.PinErr
+	if rerr != nil {
+		return rerr
+	}
 	return nil
 }
 
-// Load loads up to max junk pins from PinStore for cleanup. It loads all junk pins available in PinStore if
-// max == 0.
-func (d *deleter) Load(max int) ([]*md.Junk, *pe.PinErr) {
-	clog := logging.WithFuncName()
-	// get stale pin data with PinStore
-	jks, err := d.PS.Junk(max)
+// writeReport writes rep to the file at path, or to stderr if path is empty
+func writeReport(rep *deleter.Report, path string) error {
+	if path == "" {
+		return rep.Write(os.Stderr)
+	}
+	f, err := os.Create(path)
 	if err != nil {
-		clog.WithError(err).Error("error loading junk pins from PinStore")
-		return nil, err
-	}
-	clog.Debug("successfully loaded junk pins from PinStore")
-	// query local cache to filter out pins which are already WIP
-	newJks := []*md.Junk{}
-	for _, jk := range jks {
-		if _, err := d.wipCache.Get(jk.PinID); err != nil {
-			if err == gcache.KeyNotFoundError {
-				newJks = append(newJks, jk)
-			} else {
-				msg := "error getting pin id from local cache"
-				clog.WithError(err).Error(msg)
-				return nil, pe.ErrServiceFailure(msg).WithCause(err)
-			}
+		return err
+	}
+	if err := rep.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// checkTTL lists IDs of pins without expiry in ps, one per line, and expires them if repair is set
+func checkTTL(ctx context.Context, ps *st.RedisStore, repair bool, out io.Writer) error {
+	ids, err := ps.CheckTTL(ctx, repair)
+	for _, id := range ids {
+		if _, werr := fmt.Fprintln(out, id); werr != nil {
+			return werr
 		}
 	}
-	// cache the ids of these pins in WIP cache in best-effort manner - pin id which we failed to set in cache
-	// will be picked up by deleter in its next sweep
-	execPoolSize := viper.GetInt(cst.EnvDeleterExecutorPoolSize)
-	exp := viper.GetDuration(cst.EnvDeleterWIPCacheEntryExpiry)
-	quotas := make(chan struct{}, execPoolSize)
-	for _, jk := range newJks {
-		go func(id string) {
-			quotas <- struct{}{}
-			defer func() { <-quotas }()
-			if err := d.wipCache.SetWithExpire(id, struct{}{}, exp); err != nil {
-				clog.WithError(err).Errorf("error keying pin id %s in local cache", id)
-			}
-		}(jk.PinID)
+	logging.WithFuncName().WithFields(log.Fields{"count": len(ids), "repair": repair}).Info("done checking pin expiry")
+	if err != nil {
+		return err
 	}
-	return newJks, nil
+	return nil
 }
 
-func (d *deleter) Delete(j *md.Junk) *pe.PinErr {
-	clog := logging.WithFuncName().WithField("pinID", j.PinID)
-	// remove all pin attachment files from FileStore
-	errs, done := make(chan *pe.PinErr, len(j.FileRefs)), make(chan struct{})
-	var wg sync.WaitGroup
-	wg.Add(len(j.FileRefs))
-	// waiter
-	go func() {
-		wg.Wait()
-		close(done)
-	}()
-	// spawn ref deleters
-	for _, ref := range j.FileRefs {
-		// no need to limit the concurrency since we had limited the number of attachments
-		// per pin in a very low number
-		go func(r string) {
-			defer wg.Done()
-			if err := d.FS.Delete(r); err != nil {
-				clog.WithError(err).WithField("ref", r).
-					Errorf("error deleting pin attachment with FileStore")
-				errs <- err
+// manageQuarantine carries out the quarantine management operation requested by command line flags, and
+// reports whether there was one
+func manageQuarantine(ctx context.Context, ps st.PinStore, out io.Writer) (bool, error) {
+	switch {
+	case *flagListQuarantine:
+		fs, err := ps.Quarantined(ctx)
+		if err != nil {
+			return true, err
+		}
+		enc := json.NewEncoder(out)
+		for _, f := range fs {
+			if err := enc.Encode(f); err != nil {
+				return true, err
 			}
-		}(ref)
+		}
+	case *flagRetry != "":
+		if err := ps.Requeue(ctx, *flagRetry); err != nil {
+			return true, err
+		}
+	case *flagDiscard != "":
+		if err := ps.Discard(ctx, *flagDiscard); err != nil {
+			return true, err
+		}
+	default:
+		return false, nil
 	}
-	select {
-	case err := <-errs:
-		// ok to return without getting all errors due to the use of buffered chan
+	return true, nil
+}
+
+// reconcile deletes attachment files older than grace which belong to no registered pin, e.g. files saved by a
+// server which crashed before registering their pin, or left behind by deletions cut off halfway. The grace
+// period keeps files of pins being created intact
+func reconcile(ctx context.Context, ps st.PinStore, fs st.FileStore, grace time.Duration) error {
+	clog := logging.WithFuncName().WithContext(ctx).WithField("grace", grace)
+	cutoff := time.Now().Add(-grace)
+	// FileStore walks files pin by pin, hence caching refs of the latest pin only suffices
+	var (
+		lastPinID string
+		refs      map[string]struct{} // nil if the pin is not registered
+	)
+	var scanned, orphaned, failed int
+	err := fs.Walk(ctx, func(pinID, ref string, modTime time.Time) error {
+		scanned++
+		if modTime.After(cutoff) {
+			return nil
+		}
+		if pinID != lastPinID {
+			lastPinID, refs = pinID, nil
+			rs, err := ps.Refs(ctx, pinID)
+			if err != nil && err.Code != pe.ErrCodeNotFound {
+				return err
+			}
+			if err == nil {
+				refs = make(map[string]struct{}, len(rs))
+				for _, r := range rs {
+					refs[r] = struct{}{}
+				}
+			}
+		}
+		if _, ok := refs[ref]; ok {
+			return nil
+		}
+		orphaned++
+		flog := clog.WithFields(log.Fields{"pinID": pinID, "ref": ref, "modTime": modTime})
+		if err := fs.Delete(ctx, ref); err != nil {
+			failed++
+			flog.WithError(err).Error("error deleting orphaned attachment")
+			return nil
+		}
+		flog.Info("deleted orphaned attachment")
+		return nil
+	})
+	clog = clog.WithFields(log.Fields{"scanned": scanned, "orphaned": orphaned, "failed": failed})
+	if err != nil {
+		clog.WithError(err).Error("error reconciling FileStore with PinStore")
 		return err
-	case <-done:
 	}
-	// At this point ALL the pin's attachments are cleaned up; Deregister pin from PinStore.
-	if err := d.PS.Deregister(j.PinID); err != nil {
-		clog.WithError(err).Error("error deregistering pin from PinStore")
-		return err
+	clog.Info("done reconciling FileStore with PinStore")
+	if failed > 0 {
+		return pe.ErrServiceFailure(fmt.Sprintf("failed deleting %d orphaned attachments", failed))
 	}
-	// remove corresponding pin id from local cache
-	d.wipCache.Remove(j.PinID)
 	return nil
 }
+
+// serveStatus serves endpoints exposing status of deleter d, e.g. metrics, at the given address
+func serveStatus(d *deleter.Deleter, addr string) {
+	clog := logging.WithFuncName().WithField("addr", addr)
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/healthz", d.HandleHealthz)
+	mux.HandleFunc("/readyz", d.HandleReadyz)
+	clog.Info("serving status endpoints")
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		clog.WithError(err).Error("error serving status endpoints")
+	}
+}